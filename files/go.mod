@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/bytedance/sonic v1.12.2
 	github.com/gofiber/fiber/v2 v2.52.5
+	github.com/klauspost/compress v1.17.0
 	github.com/rs/zerolog v1.33.0
 	gopkg.in/ini.v1 v1.67.0
 )
@@ -15,7 +16,6 @@ require (
 	github.com/cloudwego/base64x v0.1.4 // indirect
 	github.com/cloudwego/iasm v0.2.0 // indirect
 	github.com/google/uuid v1.5.0 // indirect
-	github.com/klauspost/compress v1.17.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
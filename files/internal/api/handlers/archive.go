@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
 	"files/internal/core/archive"
+	"files/internal/core/task"
 	"files/internal/models"
 	"fmt"
+	"io"
 	"path/filepath"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
@@ -26,7 +31,11 @@ func (h *Handlers) viewHandler(c *fiber.Ctx) error {
 		return models.RespondWithError(c, fiber.StatusBadRequest, "Missing 'path' query parameter")
 	}
 
-	archivePath = filepath.Clean(archivePath)
+	archivePath, err := h.FileManager.ResolvePath(archivePath)
+	if err != nil {
+		return err
+	}
+
 	fileInfos, err := archive.ProcessArchiveFile(archivePath)
 	if err != nil {
 		log.Error().Err(err).Str("path", archivePath).Msg("Failed to process archive file")
@@ -40,24 +49,114 @@ func (h *Handlers) viewHandler(c *fiber.Ctx) error {
 	})
 }
 
-// UnzipHandler handles the extraction of various archive formats
-func (h *Handlers) unzipHandler(c *fiber.Ctx) error {
-	filePath, err := archive.GetAndValidateFilePath(c.Query("file"))
+// ArchiveDownloadHandler handles requests to download several entries as one archive
+func (h *Handlers) ArchiveDownloadHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.archiveDownload)
+}
+
+// ArchiveDownloadRequest represents the request format for archive downloads.
+// It can also be posted as a form so browsers save the stream natively.
+type ArchiveDownloadRequest struct {
+	Paths  []string `json:"paths" form:"paths"`
+	Format string   `json:"format" form:"format"`
+}
+
+// archiveDownload streams the requested entries as an archive built on the fly
+func (h *Handlers) archiveDownload(c *fiber.Ctx) error {
+	var req ArchiveDownloadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request payload: "+err.Error())
+	}
+
+	format, err := archive.ParseFormat(req.Format)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	sources, err := h.FileManager.PrepareSources(req.Paths)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	name := "download-" + time.Now().Format("20060102-150405")
+	if len(sources) == 1 {
+		name = filepath.Base(sources[0])
+	}
+
+	c.Set(fiber.HeaderContentType, format.ContentType())
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("attachment", name+format.Ext()))
+
+	// The status is sent before the archive is written, so a failure halfway
+	// can only be logged and leaves the client with a truncated archive
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.writeArchive(w, sources, format); err != nil {
+			h.Logger.Error("Failed to stream archive", "paths", sources, "error", err)
+		}
+	})
+	return nil
+}
+
+func (h *Handlers) writeArchive(w io.Writer, sources []string, format archive.Format) error {
+	aw, err := archive.NewWriter(w, format, archive.DefaultLevel)
 	if err != nil {
-		return models.RespondWithError(c, fiber.StatusBadRequest, err.Error())
+		return err
+	}
+	aw.Skip = h.FileManager.Trash.Contains
+
+	for _, src := range sources {
+		if err := aw.Add(context.Background(), src); err != nil {
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+// CompressHandler handles requests to create an archive from files and directories
+func (h *Handlers) CompressHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.compressFiles)
+}
+
+// CompressRequest represents the request format for creating an archive.
+// Path is the directory to create the archive in, defaulting to the
+// directory of the first source.
+type CompressRequest struct {
+	Sources  []string `json:"sources"`
+	Path     string   `json:"path"`
+	Name     string   `json:"name"`
+	Format   string   `json:"format"`
+	Level    int      `json:"level"`
+	Conflict string   `json:"conflict"`
+}
+
+// compressFiles packs the sources into an archive as a background task
+func (h *Handlers) compressFiles(c *fiber.Ctx) error {
+	var req CompressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request payload: "+err.Error())
 	}
 
-	extractor, err := archive.GetExtractor(filePath)
+	cmp, err := h.FileManager.PrepareCompress(req.Sources, req.Path, req.Name, req.Format, req.Level, req.Conflict)
 	if err != nil {
-		return models.RespondWithError(c, fiber.StatusBadRequest, err.Error())
+		return badRequest(err)
 	}
 
-	if err := extractor(filePath); err != nil {
-		log.Error().Err(err).Str("path", filePath).Msg("Failed to extract file")
-		return models.RespondWithError(c, fiber.StatusInternalServerError, fmt.Sprintf("Failed to extract file: %v", err))
+	t := h.startTask("compress", func(ctx context.Context, t *task.Task) error {
+		return h.FileManager.Compress(ctx, t, cmp)
+	})
+	return h.respondWithTask(c, t, "Archive created successfully")
+}
+
+// UnzipHandler handles the extraction of various archive formats. The
+// optional target query parameter is the directory to extract into and
+// conflict decides what happens to files that already exist.
+func (h *Handlers) unzipHandler(c *fiber.Ctx) error {
+	ex, err := h.FileManager.PrepareExtract(c.Query("file"), c.Query("target"), c.Query("conflict"))
+	if err != nil {
+		return badRequest(err)
 	}
 
-	return models.RespondWithJSON(c, fiber.StatusOK, models.Response{
-		Message: "File extracted successfully",
+	t := h.startTask("extract", func(ctx context.Context, t *task.Task) error {
+		return h.FileManager.Extract(ctx, t, ex)
 	})
+	return h.respondWithTask(c, t, "File extracted successfully")
 }
\ No newline at end of file
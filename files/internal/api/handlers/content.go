@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sniffLen is how much of a file is read to detect its content type
+const sniffLen = 512
+
+// errUnsatisfiableRange is returned when none of the requested ranges overlap the file
+var errUnsatisfiableRange = errors.New("requested range not satisfiable")
+
+// byteRange is a parsed range of a Range header
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// readCloser closes the file behind a reader once fasthttp is done streaming it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// serveContent streams the file at path with support for conditional and
+// range requests. disposition is either "inline" or "attachment".
+func serveContent(c *fiber.Ctx, path, disposition string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fiber.NewError(fiber.StatusNotFound, "File not found")
+	} else if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to open file: "+err.Error())
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to stat file: "+err.Error())
+	}
+	if info.IsDir() {
+		f.Close()
+		return fiber.NewError(fiber.StatusBadRequest, "Path is a directory")
+	}
+
+	size := info.Size()
+	modTime := info.ModTime().UTC().Truncate(time.Second)
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), size)
+
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, modTime.Format(http.TimeFormat))
+
+	if status := checkPreconditions(c, etag, modTime); status != 0 {
+		f.Close()
+		return c.SendStatus(status)
+	}
+
+	contentType, err := detectContentType(f, path)
+	if err != nil {
+		f.Close()
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to read file: "+err.Error())
+	}
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(disposition, filepath.Base(path)))
+
+	ranges, err := requestedRanges(c, etag, modTime, size)
+	if err != nil {
+		f.Close()
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return respondWithError(c, fiber.StatusRequestedRangeNotSatisfiable, err.Error())
+	}
+
+	switch len(ranges) {
+	case 0:
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Status(fiber.StatusOK).Context().SetBodyStream(f, int(size))
+	case 1:
+		r := ranges[0]
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderContentRange, r.contentRange(size))
+		c.Status(fiber.StatusPartialContent).Context().SetBodyStream(
+			readCloser{Reader: io.NewSectionReader(f, r.start, r.length), Closer: f}, int(r.length))
+	default:
+		body, boundary, length := multipartRanges(f, ranges, contentType, size)
+		c.Set(fiber.HeaderContentType, "multipart/byteranges; boundary="+boundary)
+		c.Status(fiber.StatusPartialContent).Context().SetBodyStream(body, int(length))
+	}
+	return nil
+}
+
+// checkPreconditions evaluates the conditional request headers and returns
+// 304 or 412 when the request shouldn't be served, or 0 to continue
+func checkPreconditions(c *fiber.Ctx, etag string, modTime time.Time) int {
+	if match := c.Get(fiber.HeaderIfMatch); match != "" {
+		if !etagMatches(match, etag, false) {
+			return fiber.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(c.Get(fiber.HeaderIfUnmodifiedSince)); err == nil && modTime.After(since) {
+		return fiber.StatusPreconditionFailed
+	}
+
+	if noneMatch := c.Get(fiber.HeaderIfNoneMatch); noneMatch != "" {
+		if etagMatches(noneMatch, etag, true) {
+			return fiber.StatusNotModified
+		}
+	} else if since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince)); err == nil && !modTime.After(since) {
+		return fiber.StatusNotModified
+	}
+	return 0
+}
+
+// etagMatches reports whether etag is in the comma separated list of a
+// conditional header. Weak comparison ignores the W/ prefix.
+func etagMatches(list, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedRanges returns the ranges to serve, or none to serve the whole file
+func requestedRanges(c *fiber.Ctx, etag string, modTime time.Time, size int64) ([]byteRange, error) {
+	header := c.Get(fiber.HeaderRange)
+	if header == "" || c.Method() != fiber.MethodGet {
+		return nil, nil
+	}
+
+	// A stale If-Range means the client's partial copy is outdated, send everything
+	if ifRange := c.Get("If-Range"); ifRange != "" {
+		if strings.HasPrefix(ifRange, `"`) {
+			if ifRange != etag {
+				return nil, nil
+			}
+		} else if since, err := http.ParseTime(ifRange); err != nil || !modTime.Equal(since) {
+			return nil, nil
+		}
+	}
+
+	ranges, err := parseRange(header, size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ranges that add up to more than the file are cheaper to serve whole
+	var total int64
+	for _, r := range ranges {
+		total += r.length
+	}
+	if total > size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// parseRange parses a "bytes=" Range header, dropping ranges that start past the end
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, errors.New("invalid range unit")
+	}
+
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r byteRange
+		if first == "" {
+			// Suffix range, the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if n == 0 {
+				continue
+			}
+			n = min(n, size)
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if start >= size {
+				continue
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errors.New("invalid range")
+				}
+				end = min(end, size-1)
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// multipartRanges streams the ranges as a multipart/byteranges body and
+// returns it together with its boundary and exact length
+func multipartRanges(f *os.File, ranges []byteRange, contentType string, size int64) (io.ReadCloser, string, int64) {
+	partHeader := func(r byteRange) textproto.MIMEHeader {
+		return textproto.MIMEHeader{
+			fiber.HeaderContentType:  {contentType},
+			fiber.HeaderContentRange: {r.contentRange(size)},
+		}
+	}
+
+	// Measure the body by writing the part headers alone
+	var counter countingWriter
+	mw := multipart.NewWriter(&counter)
+	for _, r := range ranges {
+		mw.CreatePart(partHeader(r))
+		counter += countingWriter(r.length)
+	}
+	mw.Close()
+
+	pr, pw := io.Pipe()
+	mw = multipart.NewWriter(pw)
+	boundary := mw.Boundary()
+	go func() {
+		defer f.Close()
+		for _, r := range ranges {
+			part, err := mw.CreatePart(partHeader(r))
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(part, io.NewSectionReader(f, r.start, r.length)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+
+	return pr, boundary, int64(counter)
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// detectContentType guesses the content type from the extension, falling
+// back to sniffing the start of the file
+func detectContentType(f *os.File, path string) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// contentDisposition builds a Content-Disposition header with an ASCII
+// fallback name and the UTF-8 name for clients that support it
+func contentDisposition(disposition, name string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, url.PathEscape(name))
+}
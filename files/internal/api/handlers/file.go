@@ -3,16 +3,16 @@ package handlers
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"io"
-	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"files/internal/config"
 	"files/internal/core/file"
+	"files/internal/core/task"
 	"files/internal/models"
-	"files/internal/utils/helper"
 	"files/internal/utils/logger"
 
 	"github.com/gofiber/fiber/v2"
@@ -22,17 +22,22 @@ import (
 type Handlers struct {
 	Config      *config.Config
 	FileManager *file.FileManager
+	Tasks       *task.Manager
 	Logger      *logger.Logger
 }
 
 // NewHandlers creates a new Handlers instance with the given configuration
-func NewHandlers(cfg *config.Config, log *logger.Logger) *Handlers {
-    fileManager := file.NewFileManager(cfg)
+func NewHandlers(cfg *config.Config, log *logger.Logger) (*Handlers, error) {
+    fileManager, err := file.NewFileManager(cfg)
+    if err != nil {
+        return nil, err
+    }
     return &Handlers{
         Config:      cfg,
         FileManager: fileManager,
+        Tasks:       task.NewManager(),
         Logger:      log, // Inisialisasi logger
-    }
+    }, nil
 }
 
 // FileHandler handles file listing requests
@@ -50,6 +55,11 @@ func (h *Handlers) DownloadHandler(c *fiber.Ctx) error {
 	return h.handleFileOperation(c, h.downloadFile)
 }
 
+// RawHandler handles requests to serve a file inline
+func (h *Handlers) RawHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.rawFile)
+}
+
 // RenameHandler handles file renaming requests
 func (h *Handlers) RenameHandler(c *fiber.Ctx) error {
 	return h.handleFileOperation(c, h.renameFile)
@@ -91,11 +101,7 @@ func (h *Handlers) handleFileOperation(c *fiber.Ctx, operation FileOperation) er
 func (h *Handlers) listFiles(c *fiber.Ctx) error {
 	currentPath, err := h.FileManager.GetDirectoryPath(c)
 	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Failed to get directory path: "+err.Error())
-	}
-
-	if !helper.IsValidPath(currentPath) {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid path")
+		return err
 	}
 
 	fileInfos, err := h.FileManager.ListDirectory(currentPath)
@@ -104,7 +110,7 @@ func (h *Handlers) listFiles(c *fiber.Ctx) error {
 	}
 
 	previousPath := filepath.Dir(currentPath)
-	if currentPath == previousPath {
+	if h.FileManager.Resolver.IsRoot(currentPath) {
 		previousPath = ""
 	}
 
@@ -118,25 +124,34 @@ func (h *Handlers) listFiles(c *fiber.Ctx) error {
 // deleteFile handles file deletion
 func (h *Handlers) deleteFile(c *fiber.Ctx) error {
 	var payload struct {
-		Path string `json:"path"`
+		Path      string   `json:"path"`
+		Paths     []string `json:"paths"`
+		Recursive bool     `json:"recursive"`
+		Permanent bool     `json:"permanent"`
 	}
 
 	if err := c.BodyParser(&payload); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Failed to decode request payload: "+err.Error())
 	}
 
-	if !helper.IsValidPath(payload.Path) {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid path")
+	if payload.Path != "" {
+		payload.Paths = append(payload.Paths, payload.Path)
 	}
 
-	if err := h.FileManager.DeleteFile(payload.Path); err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete file: "+err.Error())
+	paths, err := h.FileManager.PrepareSources(payload.Paths)
+	if err != nil {
+		return badRequest(err)
 	}
 
-	h.Logger.Info("File deleted successfully", "path", payload.Path)
-	return models.RespondWithJSON(c, fiber.StatusOK, models.Response{
-		Message: "File deleted successfully",
+	opts := file.DeleteOptions{
+		Recursive: payload.Recursive,
+		Permanent: payload.Permanent,
+		User:      h.requestUser(c),
+	}
+	t := h.startTask("delete", func(ctx context.Context, t *task.Task) error {
+		return h.FileManager.Delete(ctx, t, paths, opts)
 	})
+	return h.respondWithTask(c, t, "File deleted successfully")
 }
 
 // downloadFile handles file download
@@ -146,16 +161,30 @@ func (h *Handlers) downloadFile(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "File parameter is required")
 	}
 
-	absFilePath, err := filepath.Abs(filepath.Clean(fileParam))
+	absFilePath, err := h.FileManager.ResolvePath(fileParam)
 	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid file path: "+err.Error())
+		return err
 	}
 
-	if _, err := os.Stat(absFilePath); os.IsNotExist(err) {
-		return fiber.NewError(fiber.StatusNotFound, "File not found: "+err.Error())
+	return serveContent(c, absFilePath, "attachment")
+}
+
+// rawFile handles serving a file inline, e.g. for media preview
+func (h *Handlers) rawFile(c *fiber.Ctx) error {
+	pathParam := c.Query("path")
+	if pathParam == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Path parameter is required")
 	}
 
-	return c.Download(absFilePath)
+	absFilePath, err := h.FileManager.ResolvePath(pathParam)
+	if err != nil {
+		return err
+	}
+
+	// Keep stored HTML or SVG from running scripts in the file manager's origin
+	c.Set(fiber.HeaderContentSecurityPolicy, "sandbox")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return serveContent(c, absFilePath, "inline")
 }
 
 // renameFile handles file renaming
@@ -169,12 +198,15 @@ func (h *Handlers) renameFile(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Failed to decode request payload: "+err.Error())
 	}
 
-	oldFilePath := filepath.Clean(payload.OldPath)
-	if !helper.IsValidPath(oldFilePath) || strings.Contains(payload.NewName, "..") {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid path")
+	oldFilePath, err := h.FileManager.ResolvePath(payload.OldPath)
+	if err != nil {
+		return err
 	}
 
-	newPath := filepath.Join(filepath.Dir(oldFilePath), payload.NewName)
+	newPath, err := h.FileManager.Resolver.ResolveChild(filepath.Dir(oldFilePath), payload.NewName)
+	if err != nil {
+		return err
+	}
 
 	if err := h.FileManager.RenameFile(oldFilePath, newPath); err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to rename file: "+err.Error())
@@ -196,14 +228,19 @@ func (h *Handlers) uploadFile(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "File size exceeds the maximum allowed size")
 	}
 
-	destPath := c.FormValue("path")
-	destPath = filepath.Clean(destPath)
+	destPath, err := h.FileManager.ResolvePath(c.FormValue("path"))
+	if err != nil {
+		return err
+	}
 
 	if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Unable to create directory: "+err.Error())
 	}
 
-	filePath := filepath.Join(destPath, file.Filename)
+	filePath, err := h.FileManager.Resolver.ResolveChild(destPath, filepath.Base(file.Filename))
+	if err != nil {
+		return err
+	}
 	if err := c.SaveFile(file, filePath); err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Unable to save file: "+err.Error())
 	}
@@ -226,14 +263,9 @@ func (h *Handlers) viewFile(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "File path is required")
 	}
 
-	decodedFileName, err := url.QueryUnescape(fileName)
+	filePath, err := h.FileManager.ResolvePath(fileName)
 	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid filename path: "+err.Error())
-	}
-
-	filePath, err := filepath.Abs(filepath.Clean(decodedFileName))
-	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid file path: "+err.Error())
+		return err
 	}
 
 	content, err := readFileContent(filePath)
@@ -254,9 +286,9 @@ func (h *Handlers) saveFile(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request payload: "+err.Error())
 	}
 
-	absPath, err := filepath.Abs(req.FileName)
+	absPath, err := h.FileManager.ResolvePath(req.FileName)
 	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid file path: "+err.Error())
+		return err
 	}
 
 	if err := os.WriteFile(absPath, []byte(req.Content), 0644); err != nil {
@@ -276,17 +308,17 @@ func (h *Handlers) makeNew(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
-	currentPath = file.ResolvePath(currentPath)
-	baseDir, err := os.Getwd()
+	dirPath, err := h.FileManager.ResolvePath(currentPath)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get the base directory: "+err.Error())
+		return err
 	}
 
-	if !file.IsValidPath(baseDir, currentPath) {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid current path")
+	newPath, err := h.FileManager.Resolver.ResolveChild(dirPath, name)
+	if err != nil {
+		return err
 	}
 
-	if err := file.CreateEntity(creationType, currentPath, name); err != nil {
+	if err := file.CreateEntity(creationType, newPath); err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Error creating entity: "+err.Error())
 	}
 
@@ -317,9 +349,23 @@ func parseError(err error) (int, string) {
 	if e, ok := err.(*fiber.Error); ok {
 		return e.Code, e.Message
 	}
+	if file.IsAccessError(err) {
+		return fiber.StatusForbidden, err.Error()
+	}
+	if errors.Is(err, file.ErrInvalidName) {
+		return fiber.StatusBadRequest, err.Error()
+	}
 	return fiber.StatusInternalServerError, err.Error()
 }
 
+// badRequest turns a validation error into a 400, keeping access errors as they are
+func badRequest(err error) error {
+	if file.IsAccessError(err) {
+		return err
+	}
+	return fiber.NewError(fiber.StatusBadRequest, err.Error())
+}
+
 // respondWithError is a helper function to respond with an error
 func respondWithError(c *fiber.Ctx, status int, message string) error {
 	return models.RespondWithError(c, status, message)
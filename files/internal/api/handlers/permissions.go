@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"files/internal/models"
-	"files/internal/utils/helper"
 	"os"
 	"strconv"
 
@@ -26,7 +25,12 @@ func (h *Handlers) updatePermissions(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request payload: "+err.Error())
 	}
 
-	if err := validateUpdatePermissionsInput(payload.Path, payload.Permissions); err != nil {
+	path, err := h.FileManager.ResolvePath(payload.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := validateUpdatePermissionsInput(path, payload.Permissions); err != nil {
 		return err
 	}
 
@@ -35,11 +39,11 @@ func (h *Handlers) updatePermissions(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid permissions format: "+err.Error())
 	}
 
-	if err := os.Chmod(payload.Path, fileMode); err != nil {
+	if err := os.Chmod(path, fileMode); err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update file permissions: "+err.Error())
 	}
 
-	log.Info().Str("path", payload.Path).Msg("File permissions updated successfully")
+	log.Info().Str("path", path).Msg("File permissions updated successfully")
 	return models.RespondWithJSON(c, fiber.StatusOK, models.Response{
 		Message: "File permissions updated successfully",
 	})
@@ -47,10 +51,6 @@ func (h *Handlers) updatePermissions(c *fiber.Ctx) error {
 
 // validateUpdatePermissionsInput validates the input for updating permissions
 func validateUpdatePermissionsInput(path, permissions string) error {
-	if !helper.IsValidPath(path) {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid file path")
-	}
-
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return fiber.NewError(fiber.StatusNotFound, "File not found: "+err.Error())
 	}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"files/internal/core/file"
+	"files/internal/core/task"
+	"files/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// taskWait is how long a request waits for its task before answering with 202
+// and leaving the task to run in the background
+const taskWait = 2 * time.Second
+
+// TransferRequest represents the request format for copy and move
+type TransferRequest struct {
+	Sources     []string `json:"sources"`
+	Destination string   `json:"destination"`
+	Conflict    string   `json:"conflict"`
+}
+
+// CopyHandler handles requests to copy files and directories
+func (h *Handlers) CopyHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.copyFiles)
+}
+
+// MoveHandler handles requests to move files and directories
+func (h *Handlers) MoveHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.moveFiles)
+}
+
+// ListTasksHandler handles requests to list background tasks
+func (h *Handlers) ListTasksHandler(c *fiber.Ctx) error {
+	return models.RespondWithJSON(c, fiber.StatusOK, h.Tasks.List())
+}
+
+// GetTaskHandler handles requests for the progress of a background task
+func (h *Handlers) GetTaskHandler(c *fiber.Ctx) error {
+	t, ok := h.Tasks.Get(c.Params("id"))
+	if !ok {
+		return respondWithError(c, fiber.StatusNotFound, "Task not found")
+	}
+	return models.RespondWithJSON(c, fiber.StatusOK, t.Info())
+}
+
+// CancelTaskHandler handles requests to cancel a background task
+func (h *Handlers) CancelTaskHandler(c *fiber.Ctx) error {
+	t, ok := h.Tasks.Get(c.Params("id"))
+	if !ok {
+		return respondWithError(c, fiber.StatusNotFound, "Task not found")
+	}
+	if !t.Cancel() {
+		return respondWithError(c, fiber.StatusConflict, "Task has already finished")
+	}
+	return models.RespondWithJSON(c, fiber.StatusOK, models.Response{Message: "Task cancelled"})
+}
+
+// copyFiles handles copying files into a directory
+func (h *Handlers) copyFiles(c *fiber.Ctx) error {
+	return h.transfer(c, "copy", "Files copied successfully", h.FileManager.Copy)
+}
+
+// moveFiles handles moving files into a directory
+func (h *Handlers) moveFiles(c *fiber.Ctx) error {
+	return h.transfer(c, "move", "Files moved successfully", h.FileManager.Move)
+}
+
+func (h *Handlers) transfer(c *fiber.Ctx, kind, message string, run func(context.Context, *task.Task, *file.Transfer) error) error {
+	var req TransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request payload: "+err.Error())
+	}
+
+	transfer, err := h.FileManager.PrepareTransfer(req.Sources, req.Destination, req.Conflict)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	t := h.startTask(kind, func(ctx context.Context, t *task.Task) error {
+		return run(ctx, t, transfer)
+	})
+	return h.respondWithTask(c, t, message)
+}
+
+// startTask runs fn as a background task and logs its outcome
+func (h *Handlers) startTask(kind string, fn task.Func) *task.Task {
+	return h.Tasks.Start(kind, func(ctx context.Context, t *task.Task) error {
+		err := fn(ctx, t)
+		h.Logger.Info("Task finished", "id", t.ID(), "kind", kind, "failures", t.Failures(), "error", err)
+		return err
+	})
+}
+
+// respondWithTask answers with the finished task, or with 202 when the task
+// is still running so the client can poll /api/files/tasks/:id
+func (h *Handlers) respondWithTask(c *fiber.Ctx, t *task.Task, message string) error {
+	select {
+	case <-t.Done():
+	case <-time.After(taskWait):
+		return models.RespondWithJSON(c, fiber.StatusAccepted, models.Response{
+			Message: "Task is running in the background",
+			Data:    t.Info(),
+		})
+	}
+
+	info := t.Info()
+	if info.Status == string(task.StatusFailed) {
+		return models.RespondWithJSON(c, fiber.StatusInternalServerError, models.Response{Message: info.Error, Data: info})
+	}
+
+	failures := t.Failures()
+	switch {
+	case failures > 0 && failures == len(info.Results):
+		return models.RespondWithJSON(c, fiber.StatusInternalServerError, models.Response{Message: info.Results[0].Error, Data: info})
+	case failures > 0:
+		message = fmt.Sprintf("Finished with %d of %d failed", failures, len(info.Results))
+	}
+	return models.RespondWithJSON(c, fiber.StatusOK, models.Response{Message: message, Data: info})
+}
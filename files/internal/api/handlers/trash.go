@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"files/internal/core/file"
+	"files/internal/core/task"
+	"files/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TrashListHandler handles requests to list the trash
+func (h *Handlers) TrashListHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.listTrash)
+}
+
+// TrashRestoreHandler handles requests to restore entries from the trash
+func (h *Handlers) TrashRestoreHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.restoreTrash)
+}
+
+// TrashEmptyHandler handles requests to empty the trash
+func (h *Handlers) TrashEmptyHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.emptyTrash)
+}
+
+// listTrash handles listing the trashed entries
+func (h *Handlers) listTrash(c *fiber.Ctx) error {
+	items, err := h.FileManager.Trash.List()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to list trash: "+err.Error())
+	}
+	return models.RespondWithJSON(c, fiber.StatusOK, items)
+}
+
+// restoreTrash handles restoring trashed entries to their original location
+func (h *Handlers) restoreTrash(c *fiber.Ctx) error {
+	var payload struct {
+		IDs      []string `json:"ids"`
+		Conflict string   `json:"conflict"`
+	}
+
+	if err := c.BodyParser(&payload); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request payload: "+err.Error())
+	}
+	if len(payload.IDs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one trash ID is required")
+	}
+
+	policy, err := file.ParseConflictPolicy(payload.Conflict)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	t := h.startTask("restore", func(ctx context.Context, t *task.Task) error {
+		return h.FileManager.Trash.Restore(ctx, t, payload.IDs, policy)
+	})
+	return h.respondWithTask(c, t, "Restored successfully")
+}
+
+// emptyTrash handles permanently deleting everything in the trash
+func (h *Handlers) emptyTrash(c *fiber.Ctx) error {
+	t := h.startTask("empty-trash", h.FileManager.Trash.Empty)
+	return h.respondWithTask(c, t, "Trash emptied")
+}
+
+// requestUser identifies who made the request. The user set by an
+// authenticating reverse proxy is only taken when TrustProxyUser is enabled,
+// otherwise any client could claim to be someone else.
+func (h *Handlers) requestUser(c *fiber.Ctx) string {
+	if h.Config.Server.TrustProxyUser {
+		for _, header := range []string{"X-Forwarded-User", "X-Remote-User"} {
+			if user := c.Get(header); user != "" {
+				return strings.Clone(user)
+			}
+		}
+	}
+	return strings.Clone(c.IP())
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"files/internal/core/file"
+	"files/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// chunkChecksumHeader carries the hex encoded SHA-256 of an upload chunk
+const chunkChecksumHeader = "X-Chunk-SHA256"
+
+// CreateUploadHandler handles requests to start a resumable upload
+func (h *Handlers) CreateUploadHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.createUpload)
+}
+
+// GetUploadHandler handles requests for the state of a resumable upload
+func (h *Handlers) GetUploadHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.getUpload)
+}
+
+// UploadChunkHandler handles requests to store a chunk of a resumable upload
+func (h *Handlers) UploadChunkHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.uploadChunk)
+}
+
+// CompleteUploadHandler handles requests to finish a resumable upload
+func (h *Handlers) CompleteUploadHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.completeUpload)
+}
+
+// AbortUploadHandler handles requests to discard a resumable upload
+func (h *Handlers) AbortUploadHandler(c *fiber.Ctx) error {
+	return h.handleFileOperation(c, h.abortUpload)
+}
+
+// createUpload handles starting a resumable upload
+func (h *Handlers) createUpload(c *fiber.Ctx) error {
+	var req file.UploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request payload: "+err.Error())
+	}
+
+	info, err := h.FileManager.Uploads.Create(req)
+	if err != nil {
+		return uploadError(err)
+	}
+	return models.RespondWithJSON(c, fiber.StatusCreated, info)
+}
+
+// getUpload handles returning the received chunks of an upload
+func (h *Handlers) getUpload(c *fiber.Ctx) error {
+	info, err := h.FileManager.Uploads.Get(c.Params("id"))
+	if err != nil {
+		return uploadError(err)
+	}
+	return models.RespondWithJSON(c, fiber.StatusOK, info)
+}
+
+// uploadChunk handles storing a single chunk sent as the raw request body
+func (h *Handlers) uploadChunk(c *fiber.Ctx) error {
+	index, err := strconv.Atoi(c.Params("index"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chunk index")
+	}
+
+	// The body is streamed, so bound it before reading it into memory
+	length := c.Request().Header.ContentLength()
+	if length < 0 {
+		return fiber.NewError(fiber.StatusLengthRequired, "Content-Length is required")
+	}
+	if int64(length) > h.Config.Server.MaxUploadSize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Chunk exceeds the maximum upload size")
+	}
+
+	info, err := h.FileManager.Uploads.WriteChunk(c.Params("id"), index, c.Body(), c.Get(chunkChecksumHeader))
+	if err != nil {
+		return uploadError(err)
+	}
+	return models.RespondWithJSON(c, fiber.StatusOK, info)
+}
+
+// completeUpload handles verifying an upload and moving it into place
+func (h *Handlers) completeUpload(c *fiber.Ctx) error {
+	complete, err := h.FileManager.Uploads.Complete(c.Params("id"))
+	if err != nil {
+		return uploadError(err)
+	}
+
+	t := h.startTask("upload", complete)
+	return h.respondWithTask(c, t, "File uploaded successfully")
+}
+
+// abortUpload handles discarding an upload
+func (h *Handlers) abortUpload(c *fiber.Ctx) error {
+	if err := h.FileManager.Uploads.Abort(c.Params("id")); err != nil {
+		return uploadError(err)
+	}
+	return models.RespondWithJSON(c, fiber.StatusOK, models.Response{Message: "Upload aborted"})
+}
+
+// uploadError maps upload errors to status codes
+func uploadError(err error) error {
+	switch {
+	case errors.Is(err, file.ErrUploadNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, file.ErrUploadBusy), errors.Is(err, file.ErrUploadIncomplete):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, file.ErrInvalidUpload), errors.Is(err, file.ErrChecksumMismatch):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		return err
+	}
+}
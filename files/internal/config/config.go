@@ -23,6 +23,9 @@ type ServerConfig struct {
 	ReadTimeout       int
 	WriteTimeout      int
 	GracefulShutdown  int
+	UploadChunkSize   int64
+	StaleUploadHours  int
+	TrustProxyUser    bool
 }
 
 // FilesConfig holds file-related configuration
@@ -31,6 +34,12 @@ type FilesConfig struct {
 	ShowHiddenFiles	bool
 	MaxFileSize    	int64
 	ArchiveEnabled 	bool
+	TrashDir       	string
+	TrashRetentionDays	int
+	TrashMaxSize   	int64
+	ExtractMaxSize 	int64
+	ExtractMaxEntries	int
+	ExtractWorkers 	int
 }
 
 // Load reads the configuration file and returns a Config struct
@@ -40,7 +49,12 @@ func Load(filename string) (*Config, error) {
 		return nil, fmt.Errorf("failed to load config file: %w", err)
 	}
 
-	config := &Config{}
+	// Keys missing from the file keep these values, so the extraction limits
+	// guard against zip bombs unless they are explicitly set to 0
+	config := &Config{Files: FilesConfig{
+		ExtractMaxSize:    10 * 1024 * 1024 * 1024, // 10 GB
+		ExtractMaxEntries: 100000,
+	}}
 	err = cfg.MapTo(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to map config: %w", err)
@@ -64,6 +78,14 @@ func (c *Config) validate() error {
 		return fmt.Errorf("storage directory is required")
 	}
 
+	if c.Files.TrashRetentionDays < 0 || c.Files.TrashMaxSize < 0 {
+		return fmt.Errorf("trash retention and size cap must not be negative")
+	}
+
+	if c.Files.ExtractMaxSize < 0 || c.Files.ExtractMaxEntries < 0 || c.Files.ExtractWorkers < 0 {
+		return fmt.Errorf("extraction limits must not be negative")
+	}
+
 	if _, err := os.Stat(c.Files.StorageDir); os.IsNotExist(err) {
 		return fmt.Errorf("storage directory does not exist: %s", c.Files.StorageDir)
 	}
@@ -96,9 +118,33 @@ func (c *Config) setDefaults() {
 		c.Server.GracefulShutdown = 15 // 15 seconds
 	}
 
+	if c.Server.UploadChunkSize == 0 {
+		c.Server.UploadChunkSize = 8 * 1024 * 1024 // 8 MB
+	}
+
+	if c.Server.UploadChunkSize > c.Server.MaxUploadSize {
+		c.Server.UploadChunkSize = c.Server.MaxUploadSize
+	}
+
+	if c.Server.StaleUploadHours == 0 {
+		c.Server.StaleUploadHours = 24 // 24 hours
+	}
+
 	if c.Files.MaxFileSize == 0 {
 		c.Files.MaxFileSize = 100 * 1024 * 1024 // 50 MB
 	}
+
+	if c.Files.TrashDir == "" {
+		c.Files.TrashDir = ".trash"
+	}
+
+	if c.Files.TrashRetentionDays == 0 {
+		c.Files.TrashRetentionDays = 30
+	}
+
+	if c.Files.ExtractWorkers == 0 {
+		c.Files.ExtractWorkers = 4
+	}
 }
 
 // GetAbsoluteStoragePath returns the absolute path of the storage directory
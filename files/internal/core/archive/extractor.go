@@ -4,105 +4,280 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net/url"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"files/internal/core/task"
+	"files/internal/models"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	dirPermissions  = 0755
+	filePermissions = 0644
+	// maxLinkTarget bounds how much of a zip entry is read as a symlink target
+	maxLinkTarget = 4096
 )
 
-func GetAndValidateFilePath(filePath string) (string, error) {
-	if filePath == "" {
-		return "", errors.New("file parameter is required")
+var (
+	// ErrUnsafeEntry is returned for entries that would be written outside
+	// of the target directory
+	ErrUnsafeEntry = errors.New("unsafe archive entry")
+	// ErrLimitExceeded is returned when an archive has more entries or more
+	// uncompressed data than the extraction limits allow
+	ErrLimitExceeded = errors.New("archive exceeds the extraction limits")
+)
+
+// ExtractOptions configures Extract
+type ExtractOptions struct {
+	// Dir is the directory the archive is extracted into, it is created when missing
+	Dir string
+	// MaxSize bounds the total uncompressed size and MaxEntries the number
+	// of entries, zero means unlimited
+	MaxSize    int64
+	MaxEntries int
+	// Workers is the number of zip entries extracted at the same time
+	Workers int
+	// Prepare is called with the path of every file and link before it is
+	// created and decides where to write it
+	Prepare func(target string) (Placement, error)
+}
+
+// Placement is where Extract writes an entry, as decided by ExtractOptions.Prepare
+type Placement struct {
+	// Target is the path the entry ends up at
+	Target string
+	// Path is the path the entry is written to, Target when empty
+	Path string
+	// Skip leaves the entry out
+	Skip bool
+	// Commit, when set, moves the entry written to Path into place
+	Commit func() error
+}
+
+// CanExtract reports whether Extract supports the archive at path
+func CanExtract(path string) bool {
+	return extractFormat(path) != ""
+}
+
+// Extract unpacks the archive at archivePath into opts.Dir and records the
+// outcome of every entry on t. Entries with absolute names or names that
+// climb out of the directory, links pointing outside of it and writes
+// through existing symlinks are refused.
+func Extract(ctx context.Context, t *task.Task, archivePath string, opts ExtractOptions) error {
+	format := extractFormat(archivePath)
+	if format == "" {
+		return errors.New("unsupported file type")
 	}
 
-	decodedFilePath, err := url.QueryUnescape(filePath)
+	if err := os.MkdirAll(opts.Dir, dirPermissions); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+	dir, err := filepath.EvalSymlinks(opts.Dir)
 	if err != nil {
-		return "", fmt.Errorf("invalid file path: %w", err)
+		return fmt.Errorf("failed to resolve target directory: %w", err)
 	}
 
-	filePathClean := filepath.Clean(decodedFilePath)
-	if _, err := os.Stat(filePathClean); err != nil {
-		if os.IsNotExist(err) {
-			return "", errors.New("file does not exist")
-		}
-		return "", fmt.Errorf("failed to access file: %w", err)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	x := &extractor{dir: dir, opts: opts, t: t, cancel: cancel}
+
+	switch format {
+	case FormatZip:
+		err = x.unzip(ctx, archivePath)
+	case FormatTar, FormatTarGz, FormatTarZst:
+		err = x.untarFile(ctx, archivePath, format)
+	default:
+		err = x.gunzip(ctx, archivePath)
+	}
+	if err != nil {
+		return err
 	}
 
-	return filePathClean, nil
+	// Links are created last, so no entry is ever written through a link
+	// from the same archive
+	x.extractLinks(ctx)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrLimitExceeded) {
+		return cause
+	}
+	return ctx.Err()
 }
 
-func GetExtractor(filePath string) (func(string) error, error) {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch ext {
-	case ".zip":
-		return unzip, nil
-	case ".tar":
-		return untar, nil
-	case ".gz":
-		if strings.HasSuffix(filePath, ".tar.gz") || strings.HasSuffix(filePath, ".tgz") {
-			return untarGz, nil
-		}
-		return extractGzipFile, nil
+// extractFormat returns the format of the archive at path, or "" when it
+// can't be extracted. Plain .gz files are reported as formatGz.
+func extractFormat(path string) Format {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTarGz
+	case strings.HasSuffix(name, ".tar.zst"):
+		return FormatTarZst
+	case strings.HasSuffix(name, ".gz"):
+		return formatGz
 	default:
-		return nil, errors.New("unsupported file type")
+		return ""
 	}
 }
 
-func unzip(zipPath string) error {
-	zipFile, err := zip.OpenReader(zipPath)
+// formatGz is a single gzip compressed file, which can be extracted but not created
+const formatGz Format = "gz"
+
+// entryKind is the type of an archive entry as far as extraction cares
+type entryKind int
+
+const (
+	entryOther entryKind = iota
+	entryDir
+	entryFile
+	entrySymlink
+	entryHardlink
+)
+
+// entry is the format independent header of an archive entry
+type entry struct {
+	name     string
+	kind     entryKind
+	linkname string
+	mode     fs.FileMode
+	modTime  time.Time
+}
+
+// extractor holds the state of a single extraction
+type extractor struct {
+	dir     string
+	opts    ExtractOptions
+	t       *task.Task
+	cancel  context.CancelCauseFunc
+	written atomic.Int64
+	links   []entry
+}
+
+func (x *extractor) unzip(ctx context.Context, archivePath string) error {
+	zr, err := zip.OpenReader(archivePath)
 	if err != nil {
 		return fmt.Errorf("failed to open ZIP file: %w", err)
 	}
-	defer zipFile.Close()
+	defer zr.Close()
 
-	destDir := filepath.Dir(zipPath)
-	return extractConcurrently(len(zipFile.File), func(i int, errChan chan<- error) {
-		if err := extractZipFile(zipFile.File[i], filepath.Join(destDir, zipFile.File[i].Name)); err != nil {
-			errChan <- err
-		}
-	})
-}
+	// The central directory can lie about sizes, so these are checked again while writing
+	var total uint64
+	for _, f := range zr.File {
+		total += f.UncompressedSize64
+	}
+	if err := x.checkLimits(len(zr.File), total); err != nil {
+		return err
+	}
+	x.t.SetTotal(int64(len(zr.File)), int64(total))
 
-func extractZipFile(f *zip.File, fPath string) error {
-	if f.FileInfo().IsDir() {
-		return os.MkdirAll(fPath, os.ModePerm)
+	jobs := make(chan *zip.File)
+	var wg sync.WaitGroup
+	for i := 0; i < max(x.opts.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				e := zipEntry(f)
+				x.record(x.extract(ctx, e, func() (io.ReadCloser, error) { return f.Open() }))
+			}
+		}()
 	}
 
-	if err := os.MkdirAll(filepath.Dir(fPath), os.ModePerm); err != nil {
-		return err
+	for _, f := range zr.File {
+		if ctx.Err() != nil {
+			break
+		}
+		e := zipEntry(f)
+		if e.kind == entrySymlink {
+			if err := x.queueZipLink(f, e); err != nil {
+				x.record(failed(e.name, "", err))
+			}
+			continue
+		}
+		jobs <- f
 	}
+	close(jobs)
+	wg.Wait()
+	return nil
+}
 
-	dstFile, err := os.OpenFile(fPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-	if err != nil {
-		return fmt.Errorf("failed to create file from ZIP entry: %w", err)
+func zipEntry(f *zip.File) entry {
+	e := entry{name: f.Name, mode: f.Mode(), modTime: f.Modified}
+	switch mode := f.Mode(); {
+	case mode.IsDir():
+		e.kind = entryDir
+	case mode&fs.ModeSymlink != 0:
+		e.kind = entrySymlink
+	case mode.IsRegular():
+		e.kind = entryFile
 	}
-	defer dstFile.Close()
+	return e
+}
 
-	srcFile, err := f.Open()
+// queueZipLink reads the target of a zip symlink, which is stored as its content
+func (x *extractor) queueZipLink(f *zip.File, e entry) error {
+	r, err := f.Open()
 	if err != nil {
 		return fmt.Errorf("failed to open ZIP entry: %w", err)
 	}
-	defer srcFile.Close()
+	defer r.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	return err
+	target, err := io.ReadAll(io.LimitReader(r, maxLinkTarget+1))
+	if err != nil {
+		return fmt.Errorf("failed to read link target: %w", err)
+	}
+	if len(target) > maxLinkTarget {
+		return fmt.Errorf("%w: link target of %s is too long", ErrUnsafeEntry, e.name)
+	}
+	e.linkname = string(target)
+	x.links = append(x.links, e)
+	return nil
 }
 
-func untar(tarPath string) error {
-	file, err := os.Open(tarPath)
+func (x *extractor) untarFile(ctx context.Context, archivePath string, format Format) error {
+	file, err := os.Open(archivePath)
 	if err != nil {
 		return fmt.Errorf("failed to open TAR file: %w", err)
 	}
 	defer file.Close()
 
-	tarReader := tar.NewReader(file)
-	destDir := filepath.Dir(tarPath)
+	var r io.Reader = file
+	switch format {
+	case FormatTarGz:
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to create GZIP reader: %w", err)
+		}
+		defer gzipReader.Close()
+		r = gzipReader
+	case FormatTarZst:
+		zstdReader, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		defer zstdReader.Close()
+		r = zstdReader
+	}
 
-	for {
+	// The size of a tar is only known once it has been read, so only the
+	// number of entries processed so far is reported
+	tarReader := tar.NewReader(r)
+	entries := 0
+	for ctx.Err() == nil {
 		header, err := tarReader.Next()
 		if err == io.EOF {
 			break
@@ -110,115 +285,420 @@ func untar(tarPath string) error {
 		if err != nil {
 			return fmt.Errorf("failed to read TAR header: %w", err)
 		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
 
-		if err := extractTarFile(tarReader, header, filepath.Join(destDir, header.Name)); err != nil {
+		entries++
+		if err := x.checkLimits(entries, 0); err != nil {
 			return err
 		}
+		x.t.SetTotal(int64(entries), 0)
+
+		e := tarEntry(header)
+		if e.kind == entrySymlink || e.kind == entryHardlink {
+			x.links = append(x.links, e)
+			continue
+		}
+		x.record(x.extract(ctx, e, func() (io.ReadCloser, error) { return io.NopCloser(tarReader), nil }))
+	}
+	return nil
+}
+
+func tarEntry(header *tar.Header) entry {
+	e := entry{
+		name:     header.Name,
+		linkname: header.Linkname,
+		mode:     header.FileInfo().Mode(),
+		modTime:  header.ModTime,
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		e.kind = entryDir
+	case tar.TypeReg, tar.TypeRegA:
+		e.kind = entryFile
+	case tar.TypeSymlink:
+		e.kind = entrySymlink
+	case tar.TypeLink:
+		e.kind = entryHardlink
+	}
+	return e
+}
+
+// gunzip extracts a single gzip compressed file next to where the archive
+// would put it, named after the archive without its .gz extension
+func (x *extractor) gunzip(ctx context.Context, archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("error opening gzip file: %w", err)
+	}
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("error creating gzip reader: %w", err)
+	}
+	defer gzReader.Close()
+
+	name := filepath.Base(archivePath)
+	name = name[:len(name)-len(".gz")]
+	if name == "" {
+		name = "file"
 	}
 
+	x.t.SetTotal(1, 0)
+	e := entry{name: name, kind: entryFile, mode: filePermissions, modTime: gzReader.ModTime}
+	x.record(x.extract(ctx, e, func() (io.ReadCloser, error) { return io.NopCloser(gzReader), nil }))
 	return nil
 }
 
-func extractTarFile(tarReader *tar.Reader, header *tar.Header, fPath string) error {
-	if header.Typeflag == tar.TypeDir {
-		return os.MkdirAll(fPath, os.ModePerm)
+// extract creates a directory or file entry, open returns its content
+func (x *extractor) extract(ctx context.Context, e entry, open func() (io.ReadCloser, error)) models.OperationResult {
+	target, err := x.entryPath(e.name)
+	if err != nil {
+		return failed(e.name, "", err)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(fPath), os.ModePerm); err != nil {
-		return err
+	switch e.kind {
+	case entryDir:
+		if err := x.makeDir(target, e.mode); err != nil {
+			return failed(e.name, target, err)
+		}
+		return models.OperationResult{Source: e.name, Target: target, Status: models.ResultDone}
+	case entryFile:
+	default:
+		return models.OperationResult{
+			Source: e.name,
+			Status: models.ResultSkipped,
+			Error:  "unsupported entry type",
+		}
+	}
+
+	if err := x.makeParents(target); err != nil {
+		return failed(e.name, target, err)
+	}
+	place, err := x.prepare(target)
+	if err != nil {
+		return failed(e.name, target, err)
+	}
+	if place.Skip {
+		return models.OperationResult{Source: e.name, Target: place.Target, Status: models.ResultSkipped}
 	}
 
-	dstFile, err := os.OpenFile(fPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode))
+	r, err := open()
 	if err != nil {
-		return fmt.Errorf("failed to create file from TAR entry: %w", err)
+		return failed(e.name, place.Target, fmt.Errorf("failed to open archive entry: %w", err))
 	}
-	defer dstFile.Close()
+	defer r.Close()
 
-	_, err = io.Copy(dstFile, tarReader)
-	return err
+	if err := x.writeFile(ctx, place.Path, r, e); err != nil {
+		return failed(e.name, place.Target, err)
+	}
+	if err := place.commit(); err != nil {
+		return failed(e.name, place.Target, err)
+	}
+	return models.OperationResult{Source: e.name, Target: place.Target, Status: models.ResultDone}
 }
 
-func untarGz(tgzPath string) error {
-	file, err := os.Open(tgzPath)
+func (x *extractor) writeFile(ctx context.Context, target string, r io.Reader, e entry) error {
+	perm := e.mode.Perm()
+	if perm == 0 {
+		perm = filePermissions
+	}
+
+	// O_EXCL never follows a symlink that appeared in the meantime
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0600)
 	if err != nil {
-		return fmt.Errorf("failed to open TAR.GZ file: %w", err)
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	_, err = io.Copy(&limitWriter{ctx: ctx, w: f, x: x}, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
 	}
-	defer file.Close()
 
-	gzipReader, err := gzip.NewReader(file)
+	if !e.modTime.IsZero() {
+		os.Chtimes(target, e.modTime, e.modTime)
+	}
+	return nil
+}
+
+// extractLinks creates the queued symlinks and hard links in archive order
+func (x *extractor) extractLinks(ctx context.Context) {
+	for _, e := range x.links {
+		if ctx.Err() != nil {
+			return
+		}
+		x.record(x.extractLink(e))
+	}
+}
+
+func (x *extractor) extractLink(e entry) models.OperationResult {
+	target, err := x.entryPath(e.name)
 	if err != nil {
-		return fmt.Errorf("failed to create GZIP reader: %w", err)
+		return failed(e.name, "", err)
+	}
+	if err := x.makeParents(target); err != nil {
+		return failed(e.name, target, err)
 	}
-	defer gzipReader.Close()
 
-	tarReader := tar.NewReader(gzipReader)
-	destDir := filepath.Dir(tgzPath)
+	var source string
+	if e.kind == entrySymlink {
+		err = x.checkSymlink(target, e.linkname)
+	} else {
+		source, err = x.hardlinkSource(e.linkname)
+	}
+	if err != nil {
+		return failed(e.name, target, err)
+	}
 
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
+	place, err := x.prepare(target)
+	if err != nil {
+		return failed(e.name, target, err)
+	}
+	if place.Skip {
+		return models.OperationResult{Source: e.name, Target: place.Target, Status: models.ResultSkipped}
+	}
+
+	if e.kind == entrySymlink {
+		err = os.Symlink(e.linkname, place.Path)
+	} else {
+		err = os.Link(source, place.Path)
+	}
+	if err != nil {
+		return failed(e.name, place.Target, fmt.Errorf("failed to create link: %w", err))
+	}
+	if err := place.commit(); err != nil {
+		return failed(e.name, place.Target, err)
+	}
+	return models.OperationResult{Source: e.name, Target: place.Target, Status: models.ResultDone}
+}
+
+// entryPath maps an entry name to a path below the target directory,
+// rejecting absolute names and names that climb out of it
+func (x *extractor) entryPath(name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if slashed == "" || path.IsAbs(slashed) || filepath.IsAbs(name) {
+		return "", fmt.Errorf("%w: absolute name %q", ErrUnsafeEntry, name)
+	}
+
+	clean := path.Clean(slashed)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %q points outside of the target directory", ErrUnsafeEntry, name)
+	}
+	return filepath.Join(x.dir, filepath.FromSlash(clean)), nil
+}
+
+// makeParents creates the missing parents of target, refusing to pass
+// through symlinks which could lead out of the target directory
+func (x *extractor) makeParents(target string) error {
+	rel, err := filepath.Rel(x.dir, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+
+	current := x.dir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Another worker may be creating the same directory
+			if err := os.Mkdir(current, dirPermissions); err != nil && !errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			info, err = os.Lstat(current)
 		}
 		if err != nil {
-			return fmt.Errorf("failed to read TAR header: %w", err)
-		}
-
-		if err := extractTarFile(tarReader, header, filepath.Join(destDir, header.Name)); err != nil {
 			return err
 		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is a symlink", ErrUnsafeEntry, current)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", current)
+		}
 	}
-
 	return nil
 }
 
-func extractGzipFile(gzipFilePath string) error {
-	gzFile, err := os.Open(gzipFilePath)
+func (x *extractor) makeDir(target string, mode fs.FileMode) error {
+	if target == x.dir {
+		return nil
+	}
+	if err := x.makeParents(target); err != nil {
+		return err
+	}
+
+	perm := mode.Perm() | 0700
+	if err := os.Mkdir(target, perm); err != nil && !errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	info, err := os.Lstat(target)
 	if err != nil {
-		return fmt.Errorf("error opening gzip file: %w", err)
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s already exists and is not a directory", target)
+	}
+	return nil
+}
+
+// checkSymlink makes sure a symlink at path pointing to linkname resolves
+// inside the target directory. Climbing with .. is only allowed at the start
+// of linkname, where the parents of path are known to be real directories.
+func (x *extractor) checkSymlink(path, linkname string) error {
+	if linkname == "" || filepath.IsAbs(linkname) {
+		return fmt.Errorf("%w: link to %q is not relative", ErrUnsafeEntry, linkname)
+	}
+
+	current := filepath.Dir(path)
+	descended := false
+	for _, part := range strings.Split(linkname, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if descended {
+				return fmt.Errorf("%w: link to %q climbs out of a subdirectory", ErrUnsafeEntry, linkname)
+			}
+			current = filepath.Dir(current)
+			if !inside(x.dir, current) {
+				return fmt.Errorf("%w: link to %q points outside of the target directory", ErrUnsafeEntry, linkname)
+			}
+		default:
+			descended = true
+			current = filepath.Join(current, part)
+		}
 	}
-	defer gzFile.Close()
 
-	gzReader, err := gzip.NewReader(gzFile)
+	// Parts of the target that already exist may be symlinks themselves
+	resolved, err := resolveExisting(current)
 	if err != nil {
-		return fmt.Errorf("error creating gzip reader: %w", err)
+		return err
 	}
-	defer gzReader.Close()
+	if !inside(x.dir, resolved) {
+		return fmt.Errorf("%w: link to %q points outside of the target directory", ErrUnsafeEntry, linkname)
+	}
+	return nil
+}
 
-	destFileName := filepath.Join(filepath.Dir(gzipFilePath), gzReader.Name)
-	outFile, err := os.OpenFile(destFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+// hardlinkSource returns the extracted file a hard link entry refers to
+func (x *extractor) hardlinkSource(linkname string) (string, error) {
+	source, err := x.entryPath(linkname)
 	if err != nil {
-		return fmt.Errorf("error creating output file: %w", err)
+		return "", err
 	}
-	defer outFile.Close()
 
-	_, err = io.Copy(outFile, gzReader)
+	info, err := os.Lstat(source)
 	if err != nil {
-		return fmt.Errorf("error copying data to output file: %w", err)
+		return "", fmt.Errorf("link source %s not found", linkname)
 	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%w: link source %s is not a regular file", ErrUnsafeEntry, linkname)
+	}
+	if resolved, err := filepath.EvalSymlinks(source); err != nil || resolved != source {
+		return "", fmt.Errorf("%w: link source %s is reached through a symlink", ErrUnsafeEntry, linkname)
+	}
+	return source, nil
+}
+
+func (x *extractor) prepare(target string) (Placement, error) {
+	if x.opts.Prepare == nil {
+		return Placement{Target: target, Path: target}, nil
+	}
+	place, err := x.opts.Prepare(target)
+	if place.Target == "" {
+		place.Target = target
+	}
+	if place.Path == "" {
+		place.Path = place.Target
+	}
+	return place, err
+}
+
+func (p Placement) commit() error {
+	if p.Commit == nil {
+		return nil
+	}
+	return p.Commit()
+}
 
+// checkLimits fails once entries or size go past the configured limits
+func (x *extractor) checkLimits(entries int, size uint64) error {
+	if x.opts.MaxEntries > 0 && entries > x.opts.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, x.opts.MaxEntries)
+	}
+	if x.opts.MaxSize > 0 && size > uint64(x.opts.MaxSize) {
+		return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, x.opts.MaxSize)
+	}
 	return nil
 }
 
-func extractConcurrently(numTasks int, extractFunc func(int, chan<- error)) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error, numTasks)
+func (x *extractor) record(result models.OperationResult) {
+	x.t.AddResult(result)
+	x.t.AddItems(1)
+}
 
-	for i := 0; i < numTasks; i++ {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			extractFunc(i, errChan)
-		}(i)
+func failed(name, target string, err error) models.OperationResult {
+	return models.OperationResult{
+		Source: name,
+		Target: target,
+		Status: models.ResultFailed,
+		Error:  err.Error(),
 	}
+}
 
-	wg.Wait()
-	close(errChan)
+// limitWriter counts the bytes extracted across all entries and aborts the
+// extraction once they exceed the size limit
+type limitWriter struct {
+	ctx context.Context
+	w   io.Writer
+	x   *extractor
+}
 
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if err := lw.ctx.Err(); err != nil {
+		return 0, context.Cause(lw.ctx)
+	}
+	written := lw.x.written.Add(int64(len(p)))
+	if err := lw.x.checkLimits(0, uint64(written)); err != nil {
+		lw.x.cancel(err)
+		return 0, err
 	}
+	n, err := lw.w.Write(p)
+	lw.x.t.AddBytes(int64(n))
+	return n, err
+}
 
-	return nil
-}
\ No newline at end of file
+// inside reports whether path is base or below it
+func inside(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// resolveExisting evaluates the symlinks of the longest existing prefix of
+// path and appends the elements that don't exist yet
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
@@ -0,0 +1,311 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is an archive format that can be written
+type Format string
+
+const (
+	FormatZip    Format = "zip"
+	FormatTar    Format = "tar"
+	FormatTarGz  Format = "tar.gz"
+	FormatTarZst Format = "tar.zst"
+)
+
+// Compression levels share the 1 (fastest) to 9 (smallest) scale of gzip
+// for every format, DefaultLevel picks the default of the format
+const (
+	DefaultLevel = 0
+	MinLevel     = 1
+	MaxLevel     = 9
+)
+
+// ValidateLevel checks that level is DefaultLevel or within MinLevel and MaxLevel
+func ValidateLevel(level int) error {
+	if level != DefaultLevel && (level < MinLevel || level > MaxLevel) {
+		return fmt.Errorf("compression level must be between %d and %d", MinLevel, MaxLevel)
+	}
+	return nil
+}
+
+// ParseFormat validates an archive format, defaulting to zip
+func ParseFormat(format string) (Format, error) {
+	switch f := Format(strings.ToLower(format)); f {
+	case "":
+		return FormatZip, nil
+	case FormatZip, FormatTar, FormatTarGz, FormatTarZst:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+// Ext returns the file extension of the format, including the dot
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatZip:
+		return "application/zip"
+	case FormatTarGz:
+		return "application/gzip"
+	case FormatTarZst:
+		return "application/zstd"
+	default:
+		return "application/x-tar"
+	}
+}
+
+// Writer streams files and directory trees into an archive. Entries are
+// written one at a time, so memory use doesn't depend on their size.
+type Writer struct {
+	// Skip reports whether a path found while walking a directory is left
+	// out, skipped directories are not descended into
+	Skip func(path string) bool
+	// Progress is called for every walked entry with items set to 1, and
+	// with the number of bytes as file content is written
+	Progress func(items, bytes int64)
+
+	zw         *zip.Writer
+	tw         *tar.Writer
+	compressor io.WriteCloser
+	names      map[string]bool
+}
+
+// NewWriter creates a Writer writing an archive of the given format and
+// compression level to w. Plain tar archives ignore the level.
+func NewWriter(w io.Writer, format Format, level int) (*Writer, error) {
+	if err := ValidateLevel(level); err != nil {
+		return nil, err
+	}
+	a := &Writer{names: make(map[string]bool)}
+
+	switch format {
+	case FormatZip:
+		a.zw = zip.NewWriter(w)
+		if level != DefaultLevel {
+			a.zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(out, level)
+			})
+		}
+		return a, nil
+	case FormatTar:
+	case FormatTarGz:
+		if level == DefaultLevel {
+			level = gzip.DefaultCompression
+		}
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+		}
+		a.compressor = gw
+	case FormatTarZst:
+		// A single encoder goroutine keeps the memory use of the stream bounded
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != DefaultLevel {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		zw, err := zstd.NewWriter(w, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		a.compressor = zw
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+
+	if a.compressor != nil {
+		w = a.compressor
+	}
+	a.tw = tar.NewWriter(w)
+	return a, nil
+}
+
+// Add writes root into the archive under its base name, walking directories
+// recursively. Symlinks are stored as links and never followed.
+func (a *Writer) Add(ctx context.Context, root string) error {
+	base := a.uniqueName(filepath.Base(root))
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path != root && a.Skip != nil && a.Skip(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(base, rel))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := a.addEntry(ctx, path, name, info); err != nil {
+			return err
+		}
+		a.progress(1, 0)
+		return nil
+	})
+}
+
+// Close finishes the archive. It doesn't close the underlying writer.
+func (a *Writer) Close() error {
+	if a.zw != nil {
+		return a.zw.Close()
+	}
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if a.compressor != nil {
+		return a.compressor.Close()
+	}
+	return nil
+}
+
+func (a *Writer) addEntry(ctx context.Context, path, name string, info fs.FileInfo) error {
+	mode := info.Mode()
+	if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+		// Devices, sockets and pipes have no content worth archiving
+		return nil
+	}
+
+	var link string
+	if mode&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+
+	if a.zw != nil {
+		return a.addZipEntry(ctx, path, name, info, link)
+	}
+	return a.addTarEntry(ctx, path, name, info, link)
+}
+
+func (a *Writer) addZipEntry(ctx context.Context, path, name string, info fs.FileInfo, link string) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if !info.Mode().IsRegular() {
+		header.Method = zip.Store
+	} else {
+		header.Method = zip.Deflate
+	}
+
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write ZIP header for %s: %w", name, err)
+	}
+
+	switch {
+	case link != "":
+		_, err = io.WriteString(w, link)
+		return err
+	case info.Mode().IsRegular():
+		return a.copyContent(ctx, w, path, info.Size())
+	}
+	return nil
+}
+
+func (a *Writer) addTarEntry(ctx context.Context, path, name string, info fs.FileInfo, link string) error {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if err := a.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write TAR header for %s: %w", name, err)
+	}
+	if info.Mode().IsRegular() {
+		return a.copyContent(ctx, a.tw, path, info.Size())
+	}
+	return nil
+}
+
+// copyContent copies exactly size bytes of the file at path into w
+func (a *Writer) copyContent(ctx context.Context, w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.CopyN(&contentWriter{ctx: ctx, w: w, a: a}, f, size)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s was truncated while it was being archived", path)
+	}
+	return err
+}
+
+// uniqueName keeps top level entries with the same base name apart
+func (a *Writer) uniqueName(name string) string {
+	ext := filepath.Ext(name)
+	unique := name
+	for i := 1; a.names[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	a.names[unique] = true
+	return unique
+}
+
+func (a *Writer) progress(items, bytes int64) {
+	if a.Progress != nil {
+		a.Progress(items, bytes)
+	}
+}
+
+// contentWriter reports the progress of a copy and stops it once its
+// context is cancelled
+type contentWriter struct {
+	ctx context.Context
+	w   io.Writer
+	a   *Writer
+}
+
+func (cw *contentWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := cw.w.Write(p)
+	cw.a.progress(0, int64(n))
+	return n, err
+}
@@ -0,0 +1,160 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"files/internal/core/archive"
+	"files/internal/core/task"
+	"files/internal/models"
+)
+
+// Compression is a validated request to pack several sources into an archive
+type Compression struct {
+	Sources []string
+	Target  string
+	Format  archive.Format
+	Level   int
+	Policy  ConflictPolicy
+}
+
+// PrepareCompress resolves and validates the sources and the archive to
+// create in dir. The format extension is added to name unless it has it.
+func (fm *FileManager) PrepareCompress(sources []string, dir, name, format string, level int, policy string) (*Compression, error) {
+	archiveFormat, err := archive.ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.ValidateLevel(level); err != nil {
+		return nil, err
+	}
+
+	conflict, err := ParseConflictPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	if policy == "" {
+		// Never silently drop the work of a compression
+		conflict = ConflictRename
+	}
+
+	if len(sources) == 0 {
+		return nil, errors.New("at least one source is required")
+	}
+	resolved, err := fm.resolveSources(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir == "" {
+		dir = filepath.Dir(resolved[0])
+	}
+	dest, err := fm.ResolvePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dest); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("destination %s is not a directory", dir)
+	}
+
+	if name == "" {
+		name = filepath.Base(resolved[0])
+	}
+	if !strings.HasSuffix(strings.ToLower(name), archiveFormat.Ext()) {
+		name += archiveFormat.Ext()
+	}
+	target, err := fm.Resolver.ResolveChild(dest, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Compression{
+		Sources: resolved,
+		Target:  target,
+		Format:  archiveFormat,
+		Level:   level,
+		Policy:  conflict,
+	}, nil
+}
+
+// Compress writes the sources of cmp into a new archive. The archive is
+// written to a temporary file next to the target and only moved into place
+// once it is complete.
+func (fm *FileManager) Compress(ctx context.Context, t *task.Task, cmp *Compression) error {
+	if _, err := measureAll(ctx, t, cmp.Sources); err != nil {
+		return err
+	}
+
+	result := models.OperationResult{Source: strings.Join(cmp.Sources, ", "), Target: cmp.Target}
+	if err := fm.compress(ctx, t, cmp, &result); err != nil {
+		result.Status = models.ResultFailed
+		result.Error = err.Error()
+	}
+	t.AddResult(result)
+	return ctx.Err()
+}
+
+func (fm *FileManager) compress(ctx context.Context, t *task.Task, cmp *Compression, result *models.OperationResult) error {
+	if _, err := os.Lstat(cmp.Target); err == nil && cmp.Policy == ConflictSkip {
+		result.Status = models.ResultSkipped
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cmp.Target), "."+filepath.Base(cmp.Target)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	aw, err := archive.NewWriter(tmp, cmp.Format, cmp.Level)
+	if err != nil {
+		return err
+	}
+	aw.Skip = func(path string) bool {
+		return path == tmp.Name() || fm.Trash.Contains(path)
+	}
+	aw.Progress = func(items, bytes int64) {
+		t.AddItems(items)
+		t.AddBytes(bytes)
+	}
+
+	for _, src := range cmp.Sources {
+		t.SetCurrent(src)
+		if err := aw.Add(ctx, src); err != nil {
+			return fmt.Errorf("failed to add %s: %w", src, err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	place, skip, err := prepareTarget(tmp.Name(), cmp.Target, cmp.Policy)
+	if err != nil {
+		return err
+	}
+	result.Target = place.target
+	if skip {
+		result.Status = models.ResultSkipped
+		return nil
+	}
+
+	if err := os.Rename(tmp.Name(), place.write); err != nil {
+		return fmt.Errorf("failed to move archive into place: %w", err)
+	}
+	if err := place.commit(); err != nil {
+		return err
+	}
+	result.Status = models.ResultDone
+	return nil
+}
@@ -0,0 +1,83 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"files/internal/core/archive"
+	"files/internal/core/task"
+)
+
+// Extraction is a validated request to unpack an archive into a directory
+type Extraction struct {
+	Archive string
+	Dir     string
+	Policy  ConflictPolicy
+}
+
+// PrepareExtract resolves and validates the archive and the directory to
+// extract it into, which defaults to the directory of the archive
+func (fm *FileManager) PrepareExtract(archivePath, dir, policy string) (*Extraction, error) {
+	conflict, err := ParseConflictPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	if policy == "" {
+		// Extraction used to replace existing files, keep that behaviour
+		conflict = ConflictOverwrite
+	}
+
+	if archivePath == "" {
+		return nil, errors.New("file parameter is required")
+	}
+	src, err := fm.ResolvePath(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("file does not exist")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to access file: %w", err)
+	}
+	if !info.Mode().IsRegular() || !archive.CanExtract(src) {
+		return nil, errors.New("unsupported file type")
+	}
+
+	if dir == "" {
+		dir = filepath.Dir(src)
+	}
+	dest, err := fm.ResolvePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dest); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("target %s is not a directory", dir)
+	}
+
+	return &Extraction{Archive: src, Dir: dest, Policy: conflict}, nil
+}
+
+// Extract unpacks the archive within the configured extraction limits,
+// applying the conflict policy to files and links that already exist. An
+// existing directory is never overwritten by a file or link of the same name.
+func (fm *FileManager) Extract(ctx context.Context, t *task.Task, ex *Extraction) error {
+	return archive.Extract(ctx, t, ex.Archive, archive.ExtractOptions{
+		Dir:        ex.Dir,
+		MaxSize:    fm.Config.Files.ExtractMaxSize,
+		MaxEntries: fm.Config.Files.ExtractMaxEntries,
+		Workers:    fm.Config.Files.ExtractWorkers,
+		Prepare: func(target string) (archive.Placement, error) {
+			if ex.Policy == ConflictOverwrite {
+				if info, err := os.Lstat(target); err == nil && info.IsDir() {
+					return archive.Placement{}, errors.New("cannot overwrite an existing directory with a file")
+				}
+			}
+			place, skip, err := prepareTarget(ex.Archive, target, ex.Policy)
+			return archive.Placement{Target: place.target, Path: place.write, Skip: skip, Commit: place.commit}, err
+		},
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"files/internal/models"
 	"files/internal/utils/helper"
 	"fmt"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -23,36 +22,37 @@ const (
 
 // FileManager handles file operations using the application config
 type FileManager struct {
-	Config *config.Config
+	Config   *config.Config
+	Resolver *Resolver
+	Trash    *Trash
+	Uploads  *Uploads
 }
 
 // NewFileManager creates a new FileManager instance
-func NewFileManager(cfg *config.Config) *FileManager {
-	return &FileManager{Config: cfg}
-}
-
-// GetDirectoryPath extracts and validates the directory path from the request
-func (fm *FileManager) GetDirectoryPath(c *fiber.Ctx) (string, error) {
-	dir := c.Query("path")
-	if dir == "" {
-		return fm.Config.Files.StorageDir, nil
+func NewFileManager(cfg *config.Config) (*FileManager, error) {
+	resolver, err := NewResolver(cfg.Files.StorageDir)
+	if err != nil {
+		return nil, err
 	}
-
-	decodedDir, err := url.QueryUnescape(dir)
+	trash, err := NewTrash(resolver, cfg.Files)
 	if err != nil {
-		return "", fmt.Errorf("failed to unescape directory path: %w", err)
+		return nil, err
 	}
-	cleanedDir := filepath.Clean(decodedDir)
-	absPath, err := filepath.Abs(cleanedDir)
+	uploads, err := NewUploads(resolver, cfg)
 	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, err
 	}
+	return &FileManager{Config: cfg, Resolver: resolver, Trash: trash, Uploads: uploads}, nil
+}
 
-	if !strings.HasPrefix(absPath, fm.Config.Files.StorageDir) {
-		return "", errors.New("access to directory outside of storage area is forbidden")
-	}
+// ResolvePath confines a client supplied path to the storage area
+func (fm *FileManager) ResolvePath(path string) (string, error) {
+	return fm.Resolver.Resolve(path)
+}
 
-	return absPath, nil
+// GetDirectoryPath extracts and validates the directory path from the request
+func (fm *FileManager) GetDirectoryPath(c *fiber.Ctx) (string, error) {
+	return fm.ResolvePath(c.Query("path"))
 }
 
 // PrepareFileInfo prepares FileInfo slice from directory entries
@@ -71,6 +71,9 @@ func (fm *FileManager) PrepareFileInfo(files []os.DirEntry, dirPath string) ([]m
 		}
 
 		filePath := filepath.Join(dirPath, file.Name())
+		if fm.Trash.Contains(filePath) {
+			continue
+		}
 
 		if info.Size() > fm.Config.Files.MaxFileSize {
 			log.Warn().Str("file", file.Name()).Msg("File exceeds maximum size limit")
@@ -149,21 +152,26 @@ func (fm *FileManager) ListDirectory(path string) ([]models.FileInfo, error) {
 
 // CreateDirectory creates a new directory
 func (fm *FileManager) CreateDirectory(path string) error {
-	if !strings.HasPrefix(path, fm.Config.Files.StorageDir) {
-		return fmt.Errorf("cannot create directory outside of storage area")
-	}
 	if err := os.MkdirAll(path, defaultFilePermissions); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 	return nil
 }
 
-// DeleteFile deletes a file or empty directory
-func (fm *FileManager) DeleteFile(path string) error {
-	if !strings.HasPrefix(path, fm.Config.Files.StorageDir) {
-		return fmt.Errorf("cannot delete file outside of storage area")
+// DeleteFile deletes a file or empty directory, or a whole tree when recursive is set
+func (fm *FileManager) DeleteFile(path string, recursive bool) error {
+	if fm.Resolver.IsRoot(path) {
+		return errors.New("cannot delete the storage directory")
 	}
-	if err := os.Remove(path); err != nil {
+	if _, err := os.Lstat(path); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	remove := os.Remove
+	if recursive {
+		remove = os.RemoveAll
+	}
+	if err := remove(path); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 	return nil
@@ -171,8 +179,8 @@ func (fm *FileManager) DeleteFile(path string) error {
 
 // RenameFile renames a file or directory
 func (fm *FileManager) RenameFile(oldPath, newPath string) error {
-	if !strings.HasPrefix(oldPath, fm.Config.Files.StorageDir) || !strings.HasPrefix(newPath, fm.Config.Files.StorageDir) {
-		return fmt.Errorf("cannot rename file outside of storage area")
+	if fm.Resolver.IsRoot(oldPath) {
+		return errors.New("cannot rename the storage directory")
 	}
 	if err := os.Rename(oldPath, newPath); err != nil {
 		return fmt.Errorf("failed to rename file: %w", err)
@@ -188,43 +196,18 @@ func ValidateParams(creationType, name string) error {
 	if name == "" {
 		return fmt.Errorf("name parameter must be provided")
 	}
-	return nil
-}
-
-// ResolvePath returns the cleaned and defaulted current path.
-func ResolvePath(path string) string {
-	if path == "" {
-		return "." // Default to the current working directory
-	}
-	return filepath.Clean(path)
-}
-
-// IsValidPath checks if the new path is within the base directory.
-func IsValidPath(baseDir, newPath string) bool {
-	absBaseDir, err := filepath.Abs(baseDir)
-	if err != nil {
-		log.Error().Err(err).Str("baseDir", baseDir).Str("newPath", newPath).Msg("Failed to get absolute path")
-		return false
-	}
-	absNewPath, err := filepath.Abs(newPath)
-	if err != nil {
-		log.Error().Err(err).Str("baseDir", baseDir).Str("newPath", newPath).Msg("Failed to get absolute path")
-		return false
-	}
-	return strings.HasPrefix(absNewPath, absBaseDir)
+	return checkName(name)
 }
 
 // CreateEntity creates a file or directory based on the type and path provided.
-func CreateEntity(creationType, currentPath, name string) error {
-	newPath := filepath.Join(currentPath, name)
-
+func CreateEntity(creationType, newPath string) error {
 	switch creationType {
 	case "dir":
 		if err := os.Mkdir(newPath, os.ModePerm); err != nil {
 			return fmt.Errorf("failed to create new directory: %w", err)
 		}
 	case "file":
-		file, err := os.Create(newPath)
+		file, err := os.OpenFile(newPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
 		if err != nil {
 			return fmt.Errorf("failed to create new file: %w", err)
 		}
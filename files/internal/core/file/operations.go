@@ -0,0 +1,493 @@
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"files/internal/core/task"
+	"files/internal/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ConflictPolicy decides what happens when the target of a copy or move already exists
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves the existing entry alone
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing entry
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename picks a free name such as "report (1).pdf"
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ParseConflictPolicy validates a conflict policy, defaulting to skip
+func ParseConflictPolicy(policy string) (ConflictPolicy, error) {
+	switch ConflictPolicy(policy) {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return ConflictPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy %q, must be skip, overwrite or rename", policy)
+	}
+}
+
+// Transfer is a validated copy or move of several sources into a directory
+type Transfer struct {
+	Sources     []string
+	Destination string
+	Policy      ConflictPolicy
+}
+
+// PrepareTransfer resolves and validates the sources and destination of a copy or move
+func (fm *FileManager) PrepareTransfer(sources []string, destination, policy string) (*Transfer, error) {
+	conflict, err := ParseConflictPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("at least one source is required")
+	}
+
+	dest, err := fm.ResolvePath(destination)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dest); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("destination %s is not a directory", destination)
+	}
+
+	resolved, err := fm.resolveSources(sources)
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range resolved {
+		if within(src, dest) {
+			return nil, fmt.Errorf("cannot copy or move %s into itself", src)
+		}
+	}
+
+	return &Transfer{Sources: resolved, Destination: dest, Policy: conflict}, nil
+}
+
+// PrepareSources resolves and validates the paths of existing entries to
+// operate on, such as the entries to delete or to archive
+func (fm *FileManager) PrepareSources(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("at least one path is required")
+	}
+	return fm.resolveSources(paths)
+}
+
+func (fm *FileManager) resolveSources(paths []string) ([]string, error) {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		src, err := fm.ResolvePath(path)
+		if err != nil {
+			return nil, err
+		}
+		if fm.Resolver.IsRoot(src) {
+			return nil, errors.New("the storage directory itself cannot be used as a source")
+		}
+		if _, err := os.Lstat(src); err != nil {
+			return nil, fmt.Errorf("source not found: %s", path)
+		}
+		resolved = append(resolved, src)
+	}
+	return resolved, nil
+}
+
+// Copy copies the sources of a transfer recursively, reporting progress on t
+func (fm *FileManager) Copy(ctx context.Context, t *task.Task, tr *Transfer) error {
+	return fm.transfer(ctx, t, tr, false)
+}
+
+// Move moves the sources of a transfer, falling back to copy and delete when
+// the destination is on another filesystem
+func (fm *FileManager) Move(ctx context.Context, t *task.Task, tr *Transfer) error {
+	return fm.transfer(ctx, t, tr, true)
+}
+
+// DeleteOptions controls how Delete removes entries
+type DeleteOptions struct {
+	// Recursive allows deleting non-empty directories
+	Recursive bool
+	// Permanent skips the trash
+	Permanent bool
+	// User is recorded as the one who deleted the entries
+	User string
+}
+
+// Delete moves the given paths to the trash, or removes them for good when
+// requested
+func (fm *FileManager) Delete(ctx context.Context, t *task.Task, paths []string, opts DeleteOptions) error {
+	sizes, err := measureAll(ctx, t, paths)
+	if err != nil {
+		return err
+	}
+
+	trashed := false
+	for i, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.SetCurrent(path)
+
+		result := models.OperationResult{Source: path, Status: models.ResultDone}
+		if err := fm.deleteEntry(ctx, t, path, sizes[i], opts); err != nil {
+			result.Status = models.ResultFailed
+			result.Error = err.Error()
+		} else if !opts.Permanent {
+			trashed = true
+		}
+		t.AddResult(result)
+	}
+
+	if trashed {
+		if _, err := fm.Trash.Purge(); err != nil {
+			log.Error().Err(err).Msg("Failed to purge trash")
+		}
+	}
+	return nil
+}
+
+func (fm *FileManager) deleteEntry(ctx context.Context, t *task.Task, path string, size entrySize, opts DeleteOptions) error {
+	if opts.Permanent {
+		if err := fm.DeleteFile(path, opts.Recursive); err != nil {
+			return err
+		}
+		t.AddItems(size.items)
+		t.AddBytes(size.bytes)
+		return nil
+	}
+
+	if !opts.Recursive {
+		if entries, err := os.ReadDir(path); err == nil && len(entries) > 0 {
+			return errors.New("failed to delete file: directory not empty")
+		}
+	}
+	return fm.Trash.Put(ctx, t, path, size, opts.User)
+}
+
+// entrySize is the amount of work needed to copy a single source
+type entrySize struct {
+	items int64
+	bytes int64
+}
+
+func (fm *FileManager) transfer(ctx context.Context, t *task.Task, tr *Transfer, move bool) error {
+	sizes, err := measureAll(ctx, t, tr.Sources)
+	if err != nil {
+		return err
+	}
+
+	for i, src := range tr.Sources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.SetCurrent(src)
+
+		result := fm.transferEntry(ctx, t, src, tr, sizes[i], move)
+		t.AddResult(result)
+	}
+	return ctx.Err()
+}
+
+func (fm *FileManager) transferEntry(ctx context.Context, t *task.Task, src string, tr *Transfer, size entrySize, move bool) models.OperationResult {
+	result := models.OperationResult{Source: src}
+	fail := func(err error) models.OperationResult {
+		result.Status = models.ResultFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	target, err := fm.Resolver.ResolveChild(tr.Destination, filepath.Base(src))
+	if err != nil {
+		return fail(err)
+	}
+	result.Target = target
+
+	place, skip, err := prepareTarget(src, target, tr.Policy)
+	if err != nil {
+		return fail(err)
+	}
+	result.Target = place.target
+	if skip {
+		t.AddItems(size.items)
+		t.AddBytes(size.bytes)
+		result.Status = models.ResultSkipped
+		return result
+	}
+
+	if move {
+		err = moveEntry(ctx, t, src, place.write, size)
+	} else if err = copyEntry(ctx, t, src, place.write); err != nil {
+		os.RemoveAll(place.write)
+	}
+	if err == nil {
+		err = place.commit()
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Status = models.ResultDone
+	return result
+}
+
+// placement is where an entry ends up. An overwrite is written to a temporary
+// sibling first and only replaces the existing entry in commit, so a failed
+// copy or move leaves the existing entry as it was.
+type placement struct {
+	target string // the path the entry ends up at
+	write  string // the path to write the entry to
+}
+
+// commit moves the written entry into place
+func (p placement) commit() error {
+	if p.write == p.target {
+		return nil
+	}
+	if err := replaceEntry(p.write, p.target); err != nil {
+		os.RemoveAll(p.write)
+		return err
+	}
+	return nil
+}
+
+// prepareTarget applies the conflict policy and returns where to write the
+// entry and whether the source should be skipped
+func prepareTarget(src, target string, policy ConflictPolicy) (placement, bool, error) {
+	place := placement{target: target, write: target}
+	if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+		return place, false, nil
+	} else if err != nil {
+		return placement{}, false, fmt.Errorf("failed to check target: %w", err)
+	}
+
+	switch policy {
+	case ConflictRename:
+		free, err := freeName(target)
+		return placement{target: free, write: free}, false, err
+	case ConflictOverwrite:
+		if within(target, src) {
+			return placement{}, false, errors.New("cannot overwrite the source or a directory containing it")
+		}
+		place.write = tempSibling(target)
+		return place, false, nil
+	default:
+		return place, true, nil
+	}
+}
+
+// replaceEntry moves src over the existing entry at target. A file replaces
+// a file in one rename, anything else sets the existing entry aside and
+// removes it once src is in place.
+func replaceEntry(src, target string) error {
+	if err := os.Rename(src, target); err == nil {
+		return nil
+	}
+
+	aside := tempSibling(target)
+	if err := os.Rename(target, aside); err != nil {
+		return fmt.Errorf("failed to replace existing target: %w", err)
+	}
+	if err := os.Rename(src, target); err != nil {
+		os.Rename(aside, target)
+		return fmt.Errorf("failed to replace existing target: %w", err)
+	}
+	if err := os.RemoveAll(aside); err != nil {
+		log.Warn().Err(err).Str("path", aside).Msg("Failed to remove replaced entry")
+	}
+	return nil
+}
+
+// tempSibling returns an unused hidden name next to path
+func tempSibling(path string) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+hex.EncodeToString(b)+".tmp")
+}
+
+// freeName finds an unused name next to path by adding a " (n)" suffix
+func freeName(path string) (string, error) {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(strings.TrimSuffix(name, ext), ".tar") {
+		// Keep compound extensions such as .tar.gz together
+		ext = ".tar" + ext
+	}
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+
+	for i := 1; i < 10000; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+		if _, err := os.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name found for %s", name)
+}
+
+func moveEntry(ctx context.Context, t *task.Task, src, target string, size entrySize) error {
+	err := os.Rename(src, target)
+	if err == nil {
+		t.AddItems(size.items)
+		t.AddBytes(size.bytes)
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf("failed to move: %w", err)
+	}
+
+	if err := copyEntry(ctx, t, src, target); err != nil {
+		os.RemoveAll(target)
+		return err
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("copied, but failed to remove source: %w", err)
+	}
+	return nil
+}
+
+// copyEntry copies src to dst recursively. Symlinks are copied as links and
+// special files such as sockets and devices are left out.
+func copyEntry(ctx context.Context, t *task.Task, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+
+	switch mode := info.Mode(); {
+	case mode&fs.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return fmt.Errorf("failed to read link %s: %w", src, err)
+		}
+		if err := os.Symlink(link, dst); err != nil {
+			return fmt.Errorf("failed to create link %s: %w", dst, err)
+		}
+	case mode.IsDir():
+		if err := os.Mkdir(dst, mode.Perm()|0700); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dst, err)
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return fmt.Errorf("failed to read directory %s: %w", src, err)
+		}
+		for _, entry := range entries {
+			if err := copyEntry(ctx, t, filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		if err := os.Chmod(dst, mode.Perm()); err != nil {
+			return fmt.Errorf("failed to set permissions on %s: %w", dst, err)
+		}
+	case mode.IsRegular():
+		if err := copyFile(ctx, t, src, dst, info); err != nil {
+			return err
+		}
+	}
+
+	t.AddItems(1)
+	return nil
+}
+
+func copyFile(ctx context.Context, t *task.Task, src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+
+	if _, err := io.Copy(&progressWriter{ctx: ctx, w: out, t: t}, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// progressWriter reports written bytes on a task and stops once it is cancelled
+type progressWriter struct {
+	ctx context.Context
+	w   io.Writer
+	t   *task.Task
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.w.Write(b)
+	p.t.AddBytes(int64(n))
+	return n, err
+}
+
+// measureAll measures every path and sets the totals of t
+func measureAll(ctx context.Context, t *task.Task, paths []string) ([]entrySize, error) {
+	sizes := make([]entrySize, len(paths))
+	var total entrySize
+	for i, path := range paths {
+		size, err := measure(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = size
+		total.items += size.items
+		total.bytes += size.bytes
+	}
+	t.SetTotal(total.items, total.bytes)
+	return sizes, nil
+}
+
+// measure counts the entries and bytes below path without following symlinks
+func measure(ctx context.Context, path string) (entrySize, error) {
+	var size entrySize
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size.items++
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size.bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return size, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+	return size, nil
+}
@@ -0,0 +1,176 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidName is returned when a name is not a single path element
+var ErrInvalidName = errors.New("invalid name")
+
+// AccessError is returned when a path resolves outside of the storage directory
+type AccessError struct {
+	Path string
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("access to %s is outside of the storage area", e.Path)
+}
+
+// Resolver confines client supplied paths to the storage directory. Every file
+// operation must go through Resolve before touching the filesystem.
+type Resolver struct {
+	root     string
+	excluded []string
+}
+
+// NewResolver creates a Resolver for the given storage directory
+func NewResolver(storageDir string) (*Resolver, error) {
+	abs, err := filepath.Abs(storageDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute storage path: %w", err)
+	}
+
+	root, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage path: %w", err)
+	}
+
+	return &Resolver{root: root}, nil
+}
+
+// Root returns the resolved storage directory
+func (r *Resolver) Root() string {
+	return r.root
+}
+
+// Exclude takes the resolved directory dir out of the storage area, so that
+// paths inside it are refused like paths outside of it. It must be called
+// before the Resolver is shared.
+func (r *Resolver) Exclude(dir string) {
+	r.excluded = append(r.excluded, dir)
+}
+
+// IsRoot reports whether path is the storage directory itself
+func (r *Resolver) IsRoot(path string) bool {
+	return path == r.root
+}
+
+// Resolve turns a client supplied path into an absolute path inside the storage
+// directory. Relative paths are taken relative to the storage directory and an
+// empty path is the storage directory itself. Symlinks are followed for the
+// containment check, but the last element is returned unresolved, so operations
+// on a symlink act on the link and not on its target. Paths that don't exist
+// yet are allowed as long as their existing parent is inside the storage area.
+func (r *Resolver) Resolve(path string) (string, error) {
+	if strings.ContainsRune(path, 0) {
+		return "", &AccessError{Path: path}
+	}
+	if path == "" {
+		return r.root, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.root, path)
+	}
+	path = filepath.Clean(path)
+
+	dir, err := resolveExisting(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+
+	resolved := filepath.Join(dir, filepath.Base(path))
+	if filepath.Dir(path) == path {
+		// path is the filesystem root, which has no parent to join with
+		resolved = dir
+	}
+	if !r.allowed(resolved) {
+		return "", &AccessError{Path: path}
+	}
+
+	// A symlink must not lead out of the storage area either
+	target, err := resolveExisting(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !r.allowed(target) {
+		return "", &AccessError{Path: path}
+	}
+
+	return resolved, nil
+}
+
+// allowed reports whether path is the root or below it, and not in an
+// excluded directory
+func (r *Resolver) allowed(path string) bool {
+	if !within(r.root, path) {
+		return false
+	}
+	for _, dir := range r.excluded {
+		if within(dir, path) {
+			return false
+		}
+	}
+	return true
+}
+
+// within reports whether path is base or below it, comparing whole path
+// components so that /data2 is not mistaken for a child of /data
+func within(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// resolveExisting evaluates the symlinks of the longest existing prefix of path
+// and appends the elements that don't exist yet
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", fmt.Errorf("failed to resolve path: %w", err)
+		}
+		missing = append(missing, filepath.Base(path))
+		path = parent
+	}
+}
+
+// IsAccessError reports whether err was caused by a path outside of the storage area
+func IsAccessError(err error) bool {
+	var accessErr *AccessError
+	return errors.As(err, &accessErr)
+}
+
+// checkName makes sure name is a single path element
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || strings.ContainsRune(name, 0) {
+		return fmt.Errorf("%w %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// ResolveChild resolves the entry called name inside the already resolved directory dir
+func (r *Resolver) ResolveChild(dir, name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return r.Resolve(filepath.Join(dir, name))
+}
@@ -0,0 +1,152 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestResolver builds a storage area called data next to a data2 sibling
+// and an unrelated outside directory, with symlinks leading in and out of it
+func newTestResolver(t *testing.T) (r *Resolver, base string) {
+	t.Helper()
+
+	base = t.TempDir()
+	for _, dir := range []string{"data/dir", "data2", "outside"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"data/dir/file.txt", "data2/secret", "outside/secret"} {
+		if err := os.WriteFile(filepath.Join(base, file), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"data/escape":     filepath.Join(base, "outside"),
+		"data/escapefile": filepath.Join(base, "outside", "secret"),
+		"data/sibling":    filepath.Join("..", "data2"),
+		"data/inside":     "dir",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(base, link)); err != nil {
+			t.Skipf("symlinks are not available: %v", err)
+		}
+	}
+
+	r, err := NewResolver(filepath.Join(base, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary directory may itself live behind a symlink
+	base = filepath.Dir(r.Root())
+	return r, base
+}
+
+func TestResolveInside(t *testing.T) {
+	r, _ := newTestResolver(t)
+	root := r.Root()
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"empty is the root", "", root},
+		{"relative file", "dir/file.txt", filepath.Join(root, "dir", "file.txt")},
+		{"absolute file", filepath.Join(root, "dir", "file.txt"), filepath.Join(root, "dir", "file.txt")},
+		{"climb that stays inside", "dir/../dir/file.txt", filepath.Join(root, "dir", "file.txt")},
+		{"missing child", "dir/new.txt", filepath.Join(root, "dir", "new.txt")},
+		{"missing nested child", "dir/new/deeper.txt", filepath.Join(root, "dir", "new", "deeper.txt")},
+		{"symlink inside as last element", "inside", filepath.Join(root, "inside")},
+		{"symlink inside as parent", "inside/file.txt", filepath.Join(root, "dir", "file.txt")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(tt.path)
+			if err != nil {
+				t.Fatalf("Resolve(%q) failed: %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveOutside(t *testing.T) {
+	r, base := newTestResolver(t)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"climb to the parent", ".."},
+		{"climb to a sibling", "../data2/secret"},
+		{"climb through a subdirectory", "dir/../../outside/secret"},
+		{"climb through a missing directory", "missing/../../outside"},
+		{"absolute path outside", filepath.Join(base, "outside", "secret")},
+		{"absolute sibling sharing the prefix", filepath.Join(base, "data2")},
+		{"absolute child of the sibling", filepath.Join(base, "data2", "secret")},
+		{"filesystem root", string(filepath.Separator)},
+		{"symlink out as last element", "escape"},
+		{"symlink to an outside file", "escapefile"},
+		{"relative symlink to the sibling", "sibling"},
+		{"symlink out as parent", "escape/secret"},
+		{"missing child behind a symlink out", "escape/new.txt"},
+		{"missing nested child behind a symlink out", "escape/new/deeper.txt"},
+		{"NUL byte", "dir/file.txt\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(tt.path)
+			if err == nil {
+				t.Fatalf("Resolve(%q) = %q, want an access error", tt.path, got)
+			}
+			if !IsAccessError(err) {
+				t.Errorf("Resolve(%q) failed with %v, want an access error", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestResolveChild(t *testing.T) {
+	r, _ := newTestResolver(t)
+	dir := filepath.Join(r.Root(), "dir")
+
+	got, err := r.ResolveChild(dir, "new.txt")
+	if err != nil {
+		t.Fatalf("ResolveChild failed: %v", err)
+	}
+	if want := filepath.Join(dir, "new.txt"); got != want {
+		t.Errorf("ResolveChild = %q, want %q", got, want)
+	}
+
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "a\x00b"} {
+		if _, err := r.ResolveChild(dir, name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("ResolveChild(%q) returned %v, want ErrInvalidName", name, err)
+		}
+	}
+
+	if _, err := r.ResolveChild(r.Root(), "escape"); !IsAccessError(err) {
+		t.Errorf("ResolveChild through a symlink out returned %v, want an access error", err)
+	}
+}
+
+func TestResolveExcluded(t *testing.T) {
+	r, _ := newTestResolver(t)
+	r.Exclude(filepath.Join(r.Root(), "dir"))
+
+	for _, path := range []string{"dir", "dir/file.txt", "dir/new.txt", "inside", "inside/file.txt"} {
+		if got, err := r.Resolve(path); !IsAccessError(err) {
+			t.Errorf("Resolve(%q) = %q, %v, want an access error", path, got, err)
+		}
+	}
+	if _, err := r.Resolve("dir2"); err != nil {
+		t.Errorf("Resolve of a sibling of an excluded directory failed: %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"files/internal/config"
+	"files/internal/core/task"
+	"files/internal/models"
+
+	"github.com/bytedance/sonic"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	trashFilesDir = "files"
+	trashInfoDir  = "info"
+	trashInfoExt  = ".json"
+)
+
+// ErrTrashItemNotFound is returned for unknown trash IDs
+var ErrTrashItemNotFound = errors.New("trash item not found")
+
+// trashInfo is the metadata stored for every trashed entry
+type trashInfo struct {
+	Name         string    `json:"name"`
+	OriginalPath string    `json:"original_path"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	DeletedBy    string    `json:"deleted_by,omitempty"`
+	IsDir        bool      `json:"is_dir"`
+	Size         int64     `json:"size"`
+}
+
+// Trash keeps deleted entries below the storage directory so they can be
+// restored. Entries live in files/<id> with their metadata in info/<id>.json.
+// The trash directory is excluded from the resolver, so client supplied paths
+// can't reach into it and tamper with the metadata.
+type Trash struct {
+	dir       string
+	resolver  *Resolver
+	retention time.Duration
+	maxSize   int64
+	mu        sync.Mutex
+}
+
+// NewTrash creates the trash directory configured in cfg
+func NewTrash(resolver *Resolver, cfg config.FilesConfig) (*Trash, error) {
+	dir, err := resolver.Resolve(cfg.TrashDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trash directory: %w", err)
+	}
+	if resolver.IsRoot(dir) {
+		return nil, errors.New("trash directory must not be the storage directory")
+	}
+
+	for _, sub := range []string{trashFilesDir, trashInfoDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create trash directory: %w", err)
+		}
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve trash directory: %w", err)
+	}
+	resolver.Exclude(real)
+
+	return &Trash{
+		dir:       dir,
+		resolver:  resolver,
+		retention: time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour,
+		maxSize:   cfg.TrashMaxSize,
+	}, nil
+}
+
+// Contains reports whether path is the trash directory or inside it
+func (tr *Trash) Contains(path string) bool {
+	return within(tr.dir, path)
+}
+
+// Put moves path into the trash, recording who deleted it
+func (tr *Trash) Put(ctx context.Context, t *task.Task, path string, size entrySize, user string) error {
+	if within(path, tr.dir) {
+		return errors.New("cannot move the trash directory into the trash")
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	id := newTrashID()
+	if err := moveEntry(ctx, t, path, tr.filePath(id), size); err != nil {
+		return err
+	}
+
+	data, err := sonic.Marshal(trashInfo{
+		Name:         filepath.Base(path),
+		OriginalPath: path,
+		DeletedAt:    time.Now(),
+		DeletedBy:    user,
+		IsDir:        info.IsDir(),
+		Size:         size.bytes,
+	})
+	if err == nil {
+		err = os.WriteFile(tr.infoPath(id), data, 0600)
+	}
+	if err != nil {
+		// Without metadata the entry could never be restored, so put it back
+		os.Rename(tr.filePath(id), path)
+		return fmt.Errorf("failed to write trash info: %w", err)
+	}
+	return nil
+}
+
+// List returns the trashed entries, newest first
+func (tr *Trash) List() ([]models.TrashItem, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	ids, infos, err := tr.load()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.TrashItem, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		info := infos[i]
+		items = append(items, models.TrashItem{
+			ID:           ids[i],
+			Name:         info.Name,
+			OriginalPath: info.OriginalPath,
+			DeletedAt:    info.DeletedAt.Format(timeFormat),
+			DeletedBy:    info.DeletedBy,
+			IsDir:        info.IsDir,
+			Size:         info.Size,
+		})
+	}
+	return items, nil
+}
+
+// Restore moves trashed entries back to their original location
+func (tr *Trash) Restore(ctx context.Context, t *task.Task, ids []string, policy ConflictPolicy) error {
+	t.SetTotal(int64(len(ids)), 0)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.SetCurrent(id)
+		t.AddResult(tr.restore(ctx, t, id, policy))
+	}
+	return nil
+}
+
+func (tr *Trash) restore(ctx context.Context, t *task.Task, id string, policy ConflictPolicy) models.OperationResult {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	result := models.OperationResult{Source: id}
+	fail := func(err error) models.OperationResult {
+		result.Status = models.ResultFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	info, err := tr.readInfo(id)
+	if err != nil {
+		return fail(err)
+	}
+
+	target, err := tr.resolver.Resolve(info.OriginalPath)
+	if err != nil {
+		return fail(err)
+	}
+	result.Target = target
+
+	if err := os.MkdirAll(filepath.Dir(target), defaultFilePermissions); err != nil {
+		return fail(fmt.Errorf("failed to recreate parent directory: %w", err))
+	}
+
+	src := tr.filePath(id)
+	place, skip, err := prepareTarget(src, target, policy)
+	if err != nil {
+		return fail(err)
+	}
+	result.Target = place.target
+	if skip {
+		t.AddItems(1)
+		result.Status = models.ResultSkipped
+		return result
+	}
+
+	if err := moveEntry(ctx, t, src, place.write, entrySize{items: 1}); err != nil {
+		return fail(err)
+	}
+	if err := place.commit(); err != nil {
+		return fail(err)
+	}
+	os.Remove(tr.infoPath(id))
+
+	result.Status = models.ResultDone
+	return result
+}
+
+// Empty permanently deletes everything in the trash
+func (tr *Trash) Empty(ctx context.Context, t *task.Task) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	ids, _, err := tr.load()
+	if err != nil {
+		return err
+	}
+
+	t.SetTotal(int64(len(ids)), 0)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.SetCurrent(id)
+
+		result := models.OperationResult{Source: id, Status: models.ResultDone}
+		if err := tr.remove(id); err != nil {
+			result.Status = models.ResultFailed
+			result.Error = err.Error()
+		}
+		t.AddResult(result)
+		t.AddItems(1)
+	}
+	return nil
+}
+
+// Purge deletes entries past the retention period and the oldest entries
+// while the trash is above its size cap. It returns the number of purged entries.
+func (tr *Trash) Purge() (int, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	ids, infos, err := tr.load()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, info := range infos {
+		total += info.Size
+	}
+
+	cutoff := time.Now().Add(-tr.retention)
+	purged := 0
+	for i, id := range ids {
+		info := infos[i]
+		expired := tr.retention > 0 && info.DeletedAt.Before(cutoff)
+		overCap := tr.maxSize > 0 && total > tr.maxSize
+		if !expired && !overCap {
+			continue
+		}
+
+		if err := tr.remove(id); err != nil {
+			return purged, err
+		}
+		total -= info.Size
+		purged++
+	}
+	return purged, nil
+}
+
+// PurgeEvery runs Purge periodically for the lifetime of the process
+func (tr *Trash) PurgeEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := tr.Purge()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to purge trash")
+		} else if purged > 0 {
+			log.Info().Int("entries", purged).Msg("Purged trash")
+		}
+		<-ticker.C
+	}
+}
+
+// load reads the metadata of all entries, oldest first. Metadata whose entry
+// has gone missing is cleaned up on the way, tr.mu must be held.
+func (tr *Trash) load() ([]string, []trashInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(tr.dir, trashInfoDir))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read trash: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), trashInfoExt); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	validIDs := ids[:0]
+	var infos []trashInfo
+	for _, id := range ids {
+		info, err := tr.readInfo(id)
+		if err != nil {
+			log.Warn().Err(err).Str("id", id).Msg("Skipping broken trash entry")
+			continue
+		}
+		if _, err := os.Lstat(tr.filePath(id)); errors.Is(err, os.ErrNotExist) {
+			os.Remove(tr.infoPath(id))
+			continue
+		}
+		validIDs = append(validIDs, id)
+		infos = append(infos, info)
+	}
+	return validIDs, infos, nil
+}
+
+func (tr *Trash) readInfo(id string) (trashInfo, error) {
+	var info trashInfo
+	if checkName(id) != nil {
+		return info, ErrTrashItemNotFound
+	}
+
+	data, err := os.ReadFile(tr.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return info, ErrTrashItemNotFound
+	} else if err != nil {
+		return info, fmt.Errorf("failed to read trash info: %w", err)
+	}
+
+	if err := sonic.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("invalid trash info: %w", err)
+	}
+	return info, nil
+}
+
+func (tr *Trash) remove(id string) error {
+	if err := os.RemoveAll(tr.filePath(id)); err != nil {
+		return fmt.Errorf("failed to delete trash entry: %w", err)
+	}
+	if err := os.Remove(tr.infoPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete trash info: %w", err)
+	}
+	return nil
+}
+
+func (tr *Trash) filePath(id string) string {
+	return filepath.Join(tr.dir, trashFilesDir, id)
+}
+
+func (tr *Trash) infoPath(id string) string {
+	return filepath.Join(tr.dir, trashInfoDir, id+trashInfoExt)
+}
+
+// newTrashID returns an ID that sorts by deletion time
+func newTrashID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405.000000") + "-" + hex.EncodeToString(b)
+}
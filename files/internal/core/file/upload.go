@@ -0,0 +1,525 @@
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"files/internal/config"
+	"files/internal/core/task"
+	"files/internal/models"
+
+	"github.com/bytedance/sonic"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	uploadsDirName  = "files-uploads"
+	uploadStateFile = "upload.json"
+	uploadDataFile  = "data"
+)
+
+var (
+	// ErrUploadNotFound is returned for unknown or expired upload IDs
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadIncomplete is returned when completing an upload with missing chunks
+	ErrUploadIncomplete = errors.New("upload is missing chunks")
+	// ErrUploadBusy is returned while an upload is being completed, or when
+	// completing it while chunks are still being written
+	ErrUploadBusy = errors.New("upload is busy")
+	// ErrInvalidUpload is returned for upload parameters or chunks that don't fit the upload
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrChecksumMismatch is returned when received data doesn't match its checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// uploadState is the persisted state of a resumable upload
+type uploadState struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Destination string         `json:"destination"`
+	Size        int64          `json:"size"`
+	ChunkSize   int64          `json:"chunk_size"`
+	SHA256      string         `json:"sha256,omitempty"`
+	Conflict    ConflictPolicy `json:"conflict"`
+	Received    []bool         `json:"received"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+func (s *uploadState) chunkLength(index int) int64 {
+	return min(s.ChunkSize, s.Size-int64(index)*s.ChunkSize)
+}
+
+func (s *uploadState) complete() bool {
+	for _, received := range s.Received {
+		if !received {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *uploadState) info() models.UploadInfo {
+	received := []int{}
+	for i, ok := range s.Received {
+		if ok {
+			received = append(received, i)
+		}
+	}
+	return models.UploadInfo{
+		ID:          s.ID,
+		Name:        s.Name,
+		Destination: s.Destination,
+		Size:        s.Size,
+		ChunkSize:   s.ChunkSize,
+		TotalChunks: len(s.Received),
+		Received:    received,
+		CreatedAt:   s.CreatedAt.Format(timeFormat),
+		UpdatedAt:   s.UpdatedAt.Format(timeFormat),
+	}
+}
+
+// UploadRequest describes a new resumable upload
+type UploadRequest struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	SHA256    string `json:"sha256"`
+	Conflict  string `json:"conflict"`
+}
+
+// Uploads keeps the partial state of resumable uploads in the temp upload
+// directory. Each upload has a data file that chunks are written into at
+// their offset, next to a JSON file tracking the received chunks.
+type Uploads struct {
+	dir       string
+	resolver  *Resolver
+	maxSize   int64
+	maxChunk  int64
+	chunkSize int64
+	expiry    time.Duration
+
+	mu sync.Mutex
+	// writers counts the chunk writes in progress per upload
+	writers map[string]int
+	// completing holds the uploads that are being verified and moved into place
+	completing map[string]bool
+}
+
+// NewUploads creates the upload state directory below cfg.Server.TempUploadDir
+func NewUploads(resolver *Resolver, cfg *config.Config) (*Uploads, error) {
+	dir := filepath.Join(cfg.Server.TempUploadDir, uploadsDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	return &Uploads{
+		dir:        dir,
+		resolver:   resolver,
+		maxSize:    cfg.Files.MaxFileSize,
+		maxChunk:   cfg.Server.MaxUploadSize,
+		chunkSize:  cfg.Server.UploadChunkSize,
+		expiry:     time.Duration(cfg.Server.StaleUploadHours) * time.Hour,
+		writers:    make(map[string]int),
+		completing: make(map[string]bool),
+	}, nil
+}
+
+// Create starts a new upload and returns its state
+func (u *Uploads) Create(req UploadRequest) (models.UploadInfo, error) {
+	var info models.UploadInfo
+
+	conflict, err := ParseConflictPolicy(req.Conflict)
+	if err != nil {
+		return info, fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+	if req.Conflict == "" {
+		// Plain uploads replace existing files, keep that behaviour
+		conflict = ConflictOverwrite
+	}
+
+	if req.Size < 0 || req.Size > u.maxSize {
+		return info, fmt.Errorf("%w: file size must be between 0 and %d bytes", ErrInvalidUpload, u.maxSize)
+	}
+	chunkSize := req.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = u.chunkSize
+	}
+	if chunkSize <= 0 || chunkSize > u.maxChunk {
+		return info, fmt.Errorf("%w: chunk size must be between 1 and %d bytes", ErrInvalidUpload, u.maxChunk)
+	}
+	if req.SHA256 != "" {
+		if sum, err := hex.DecodeString(req.SHA256); err != nil || len(sum) != sha256.Size {
+			return info, fmt.Errorf("%w: sha256 must be a hex encoded SHA-256 digest", ErrInvalidUpload)
+		}
+	}
+
+	dest, err := u.resolver.Resolve(req.Path)
+	if err != nil {
+		return info, err
+	}
+	if _, err := u.resolver.ResolveChild(dest, req.Name); err != nil {
+		return info, err
+	}
+
+	now := time.Now()
+	state := &uploadState{
+		ID:          newUploadID(),
+		Name:        req.Name,
+		Destination: dest,
+		Size:        req.Size,
+		ChunkSize:   chunkSize,
+		SHA256:      strings.ToLower(req.SHA256),
+		Conflict:    conflict,
+		Received:    make([]bool, (req.Size+chunkSize-1)/chunkSize),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := os.Mkdir(u.path(state.ID), 0700); err != nil {
+		return info, fmt.Errorf("failed to create upload: %w", err)
+	}
+	data, err := os.OpenFile(u.dataPath(state.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		err = data.Truncate(state.Size)
+		data.Close()
+	}
+	if err == nil {
+		err = u.save(state)
+	}
+	if err != nil {
+		os.RemoveAll(u.path(state.ID))
+		return info, fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	return state.info(), nil
+}
+
+// Get returns the state of an upload so clients can resume it
+func (u *Uploads) Get(id string) (models.UploadInfo, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	state, err := u.load(id)
+	if err != nil {
+		return models.UploadInfo{}, err
+	}
+	return state.info(), nil
+}
+
+// WriteChunk stores chunk index of an upload. When checksum is set it must be
+// the hex encoded SHA-256 of data.
+func (u *Uploads) WriteChunk(id string, index int, data []byte, checksum string) (models.UploadInfo, error) {
+	if checksum != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), checksum) {
+			return models.UploadInfo{}, fmt.Errorf("chunk %d: %w", index, ErrChecksumMismatch)
+		}
+	}
+
+	u.mu.Lock()
+	state, err := u.load(id)
+	if err == nil && u.completing[id] {
+		err = ErrUploadBusy
+	}
+	if err != nil {
+		u.mu.Unlock()
+		return models.UploadInfo{}, err
+	}
+	// Keep the upload from being completed until the chunk is written and recorded
+	u.writers[id]++
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		if u.writers[id]--; u.writers[id] == 0 {
+			delete(u.writers, id)
+		}
+		u.mu.Unlock()
+	}()
+
+	if index < 0 || index >= len(state.Received) {
+		return models.UploadInfo{}, fmt.Errorf("%w: chunk index must be between 0 and %d", ErrInvalidUpload, len(state.Received)-1)
+	}
+	if want := state.chunkLength(index); int64(len(data)) != want {
+		return models.UploadInfo{}, fmt.Errorf("%w: chunk %d must be %d bytes, got %d", ErrInvalidUpload, index, want, len(data))
+	}
+
+	// Chunks don't overlap, so they can be written without holding the lock
+	file, err := os.OpenFile(u.dataPath(id), os.O_WRONLY, 0600)
+	if err != nil {
+		return models.UploadInfo{}, fmt.Errorf("failed to open upload: %w", err)
+	}
+	_, err = file.WriteAt(data, int64(index)*state.ChunkSize)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return models.UploadInfo{}, fmt.Errorf("failed to write chunk: %w", err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	state, err = u.load(id)
+	if err != nil {
+		return models.UploadInfo{}, err
+	}
+	state.Received[index] = true
+	state.UpdatedAt = time.Now()
+	if err := u.save(state); err != nil {
+		return models.UploadInfo{}, err
+	}
+	return state.info(), nil
+}
+
+// Complete checks that all chunks of an upload were received and returns the
+// task function that verifies the upload and moves it to its destination
+func (u *Uploads) Complete(id string) (task.Func, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	state, err := u.load(id)
+	switch {
+	case err != nil:
+		return nil, err
+	case u.completing[id] || u.writers[id] > 0:
+		return nil, ErrUploadBusy
+	case !state.complete():
+		return nil, ErrUploadIncomplete
+	}
+	u.completing[id] = true
+
+	return func(ctx context.Context, t *task.Task) error {
+		defer func() {
+			u.mu.Lock()
+			delete(u.completing, id)
+			u.mu.Unlock()
+		}()
+
+		t.SetCurrent(state.Name)
+		if state.SHA256 != "" {
+			t.SetTotal(1, state.Size)
+			if err := verifySHA256(ctx, t, u.dataPath(id), state.SHA256); err != nil {
+				return err
+			}
+		} else {
+			t.SetTotal(1, 0)
+		}
+
+		t.AddResult(u.finish(ctx, t, state))
+		return nil
+	}, nil
+}
+
+func (u *Uploads) finish(ctx context.Context, t *task.Task, state *uploadState) models.OperationResult {
+	result := models.OperationResult{Source: state.Name}
+	fail := func(err error) models.OperationResult {
+		result.Status = models.ResultFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	// Resolve again, the destination may have changed since the upload started
+	dest, err := u.resolver.Resolve(state.Destination)
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.MkdirAll(dest, os.ModePerm); err != nil {
+		return fail(fmt.Errorf("unable to create directory: %w", err))
+	}
+	target, err := u.resolver.ResolveChild(dest, state.Name)
+	if err != nil {
+		return fail(err)
+	}
+	result.Target = target
+
+	src := u.dataPath(state.ID)
+	place, skip, err := prepareTarget(src, target, state.Conflict)
+	if err != nil {
+		return fail(err)
+	}
+	result.Target = place.target
+
+	if skip {
+		result.Status = models.ResultSkipped
+	} else {
+		if err := os.Chmod(src, 0644); err != nil {
+			return fail(fmt.Errorf("failed to set permissions: %w", err))
+		}
+		if err := moveEntry(ctx, t, src, place.write, entrySize{items: 1}); err != nil {
+			return fail(err)
+		}
+		if err := place.commit(); err != nil {
+			return fail(err)
+		}
+		result.Status = models.ResultDone
+	}
+
+	u.mu.Lock()
+	err = u.remove(state.ID)
+	u.mu.Unlock()
+	if err != nil {
+		log.Warn().Err(err).Str("id", state.ID).Msg("Failed to clean up upload")
+	}
+	return result
+}
+
+// Abort discards an upload and its received chunks. An upload that is being
+// completed can't be aborted.
+func (u *Uploads) Abort(id string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.completing[id] {
+		return ErrUploadBusy
+	}
+	return u.remove(id)
+}
+
+// remove deletes the files of an upload, u.mu must be held
+func (u *Uploads) remove(id string) error {
+	if checkName(id) != nil {
+		return ErrUploadNotFound
+	}
+	if _, err := os.Stat(u.path(id)); errors.Is(err, os.ErrNotExist) {
+		return ErrUploadNotFound
+	}
+	if err := os.RemoveAll(u.path(id)); err != nil {
+		return fmt.Errorf("failed to remove upload: %w", err)
+	}
+	return nil
+}
+
+// Cleanup removes uploads that haven't received data for longer than the
+// configured expiry. It returns the number of removed uploads.
+func (u *Uploads) Cleanup() (int, error) {
+	entries, err := os.ReadDir(u.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload directory: %w", err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	cutoff := time.Now().Add(-u.expiry)
+	removed := 0
+	for _, entry := range entries {
+		id := entry.Name()
+		if u.completing[id] || u.writers[id] > 0 {
+			continue
+		}
+
+		// Fall back to the directory time for uploads with broken state
+		updated := time.Time{}
+		if state, err := u.load(id); err == nil {
+			updated = state.UpdatedAt
+		} else if info, err := entry.Info(); err == nil {
+			updated = info.ModTime()
+		}
+		if updated.After(cutoff) {
+			continue
+		}
+
+		if err := os.RemoveAll(u.path(id)); err != nil {
+			return removed, fmt.Errorf("failed to remove stale upload: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// CleanupEvery runs Cleanup periodically for the lifetime of the process
+func (u *Uploads) CleanupEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := u.Cleanup()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to clean up stale uploads")
+		} else if removed > 0 {
+			log.Info().Int("uploads", removed).Msg("Removed stale uploads")
+		}
+		<-ticker.C
+	}
+}
+
+// load reads the state of an upload, u.mu must be held
+func (u *Uploads) load(id string) (*uploadState, error) {
+	if checkName(id) != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(u.path(id), uploadStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read upload state: %w", err)
+	}
+
+	var state uploadState
+	if err := sonic.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid upload state: %w", err)
+	}
+	return &state, nil
+}
+
+// save writes the state of an upload atomically, u.mu must be held
+func (u *Uploads) save(state *uploadState) error {
+	data, err := sonic.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload state: %w", err)
+	}
+
+	path := filepath.Join(u.path(state.ID), uploadStateFile)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to save upload state: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save upload state: %w", err)
+	}
+	return nil
+}
+
+func (u *Uploads) path(id string) string {
+	return filepath.Join(u.dir, id)
+}
+
+func (u *Uploads) dataPath(id string) string {
+	return filepath.Join(u.dir, id, uploadDataFile)
+}
+
+// verifySHA256 hashes the file at path and compares it with the expected digest
+func verifySHA256(ctx context.Context, t *task.Task, path, expected string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(&progressWriter{ctx: ctx, w: hash, t: t}, file); err != nil {
+		return fmt.Errorf("failed to hash upload: %w", err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != expected {
+		return fmt.Errorf("uploaded file: %w", ErrChecksumMismatch)
+	}
+	return nil
+}
+
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
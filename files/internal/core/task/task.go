@@ -0,0 +1,249 @@
+package task
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"files/internal/models"
+)
+
+// Status is the lifecycle state of a task
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+const (
+	// retention is how long finished tasks are kept for polling
+	retention  = time.Hour
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+// Func is the work done by a task. It should stop when ctx is cancelled.
+type Func func(ctx context.Context, t *Task) error
+
+// Task is a long running file operation with progress reporting
+type Task struct {
+	id      string
+	kind    string
+	started time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	totalItems atomic.Int64
+	doneItems  atomic.Int64
+	totalBytes atomic.Int64
+	doneBytes  atomic.Int64
+
+	mu       sync.Mutex
+	status   Status
+	err      string
+	current  string
+	results  []models.OperationResult
+	finished time.Time
+}
+
+// ID returns the task identifier
+func (t *Task) ID() string {
+	return t.id
+}
+
+// Done is closed when the task has finished
+func (t *Task) Done() <-chan struct{} {
+	return t.done
+}
+
+// Cancel stops the task and reports whether it was still running
+func (t *Task) Cancel() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		t.cancel()
+		return true
+	}
+}
+
+// SetTotal sets the amount of work the task is going to do
+func (t *Task) SetTotal(items, bytes int64) {
+	t.totalItems.Store(items)
+	t.totalBytes.Store(bytes)
+}
+
+// AddItems records finished items
+func (t *Task) AddItems(n int64) {
+	t.doneItems.Add(n)
+}
+
+// AddBytes records processed bytes
+func (t *Task) AddBytes(n int64) {
+	t.doneBytes.Add(n)
+}
+
+// SetCurrent records the path the task is working on
+func (t *Task) SetCurrent(path string) {
+	t.mu.Lock()
+	t.current = path
+	t.mu.Unlock()
+}
+
+// AddResult records the outcome for a single source
+func (t *Task) AddResult(result models.OperationResult) {
+	t.mu.Lock()
+	t.results = append(t.results, result)
+	t.mu.Unlock()
+}
+
+// Failures returns the number of results that failed
+func (t *Task) Failures() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures := 0
+	for _, result := range t.results {
+		if result.Status == models.ResultFailed {
+			failures++
+		}
+	}
+	return failures
+}
+
+// Info returns a snapshot of the task
+func (t *Task) Info() models.TaskInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info := models.TaskInfo{
+		ID:         t.id,
+		Kind:       t.kind,
+		Status:     string(t.status),
+		Error:      t.err,
+		Current:    t.current,
+		TotalItems: t.totalItems.Load(),
+		DoneItems:  t.doneItems.Load(),
+		TotalBytes: t.totalBytes.Load(),
+		DoneBytes:  t.doneBytes.Load(),
+		StartedAt:  t.started.Format(timeFormat),
+		Results:    append([]models.OperationResult(nil), t.results...),
+	}
+	if !t.finished.IsZero() {
+		info.FinishedAt = t.finished.Format(timeFormat)
+	}
+	return info
+}
+
+func (t *Task) finish(ctx context.Context, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case ctx.Err() != nil:
+		t.status = StatusCancelled
+	case err != nil:
+		t.status = StatusFailed
+		t.err = err.Error()
+	default:
+		t.status = StatusCompleted
+	}
+	t.current = ""
+	t.finished = time.Now()
+	close(t.done)
+}
+
+func (t *Task) expired(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.finished.IsZero() && now.Sub(t.finished) > retention
+}
+
+// Manager runs tasks in the background and keeps them around for polling
+type Manager struct {
+	mu    sync.Mutex
+	tasks map[string]*Task
+}
+
+// NewManager creates a new task Manager
+func NewManager() *Manager {
+	return &Manager{tasks: make(map[string]*Task)}
+}
+
+// Start runs fn in the background and returns the task tracking it
+func (m *Manager) Start(kind string, fn Func) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Task{
+		id:      newID(),
+		kind:    kind,
+		started: time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		status:  StatusRunning,
+	}
+
+	m.mu.Lock()
+	m.prune()
+	m.tasks[t.id] = t
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		t.finish(ctx, fn(ctx, t))
+	}()
+
+	return t
+}
+
+// Get returns the task with the given ID
+func (m *Manager) Get(id string) (*Task, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[id]
+	return t, ok
+}
+
+// List returns a snapshot of all known tasks, newest first
+func (m *Manager) List() []models.TaskInfo {
+	m.mu.Lock()
+	m.prune()
+	tasks := make([]*Task, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		tasks = append(tasks, t)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].started.After(tasks[j].started)
+	})
+
+	infos := make([]models.TaskInfo, 0, len(tasks))
+	for _, t := range tasks {
+		infos = append(infos, t.Info())
+	}
+	return infos
+}
+
+// prune drops finished tasks past their retention, m.mu must be held
+func (m *Manager) prune() {
+	now := time.Now()
+	for id, t := range m.tasks {
+		if t.expired(now) {
+			delete(m.tasks, id)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return hex.EncodeToString(b)
+}
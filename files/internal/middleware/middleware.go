@@ -14,13 +14,25 @@ func SetupCORS(app *fiber.App) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Content-Type",
+		AllowHeaders: "Content-Type, X-Chunk-SHA256",
 	}))
 }
 
+// uncompressedPaths serve file content with byte ranges, which would no longer
+// match the body once it is compressed, or stream bodies that compression
+// would buffer in memory
+var uncompressedPaths = map[string]bool{
+	"/api/files/download":         true,
+	"/api/files/raw":              true,
+	"/api/files/archive-download": true,
+}
+
 // SetupCompression configures and applies compression middleware to the Fiber app
 func SetupCompression(app *fiber.App) {
 	app.Use(compress.New(compress.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return uncompressedPaths[c.Path()]
+		},
 		Level: compress.LevelBestSpeed,
 	}))
 }
@@ -0,0 +1,32 @@
+package models
+
+// TaskInfo describes the state and progress of a background file operation
+type TaskInfo struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Current    string            `json:"current,omitempty"`
+	TotalItems int64             `json:"total_items"`
+	DoneItems  int64             `json:"done_items"`
+	TotalBytes int64             `json:"total_bytes"`
+	DoneBytes  int64             `json:"done_bytes"`
+	StartedAt  string            `json:"started_at"`
+	FinishedAt string            `json:"finished_at,omitempty"`
+	Results    []OperationResult `json:"results,omitempty"`
+}
+
+// Outcomes of a file operation on a single source
+const (
+	ResultDone    = "done"
+	ResultSkipped = "skipped"
+	ResultFailed  = "failed"
+)
+
+// OperationResult is the outcome of a file operation on a single source
+type OperationResult struct {
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// TrashItem describes an entry in the trash
+type TrashItem struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	OriginalPath string `json:"original_path"`
+	DeletedAt    string `json:"deleted_at"`
+	DeletedBy    string `json:"deleted_by,omitempty"`
+	IsDir        bool   `json:"is_dir"`
+	Size         int64  `json:"size"`
+}
@@ -21,6 +21,13 @@ import (
 //go:embed frontend/dist/*
 var embeddedFiles embed.FS
 
+const (
+	// trashPurgeInterval is how often expired trash entries are removed
+	trashPurgeInterval = time.Hour
+	// uploadCleanupInterval is how often stale partial uploads are removed
+	uploadCleanupInterval = time.Hour
+)
+
 var log *logger.Logger
 
 func main() {
@@ -46,8 +53,13 @@ func run() error {
 	app := createFiberApp(cfg)
 
 	setupMiddleware(app,log)
-	handlers := handlers.NewHandlers(cfg, log)
+	handlers, err := handlers.NewHandlers(cfg, log)
+	if err != nil {
+		return err
+	}
 	defineAPIRoutes(app, handlers)
+	go handlers.FileManager.Trash.PurgeEvery(trashPurgeInterval)
+	go handlers.FileManager.Uploads.CleanupEvery(uploadCleanupInterval)
 	setupStaticFileServing(app, cfg.Server.UseEmbeddedFiles)
 
 	return startServer(app, cfg.Server.Port)
@@ -78,13 +90,29 @@ func defineAPIRoutes(app *fiber.App, h *handlers.Handlers) {
 	files.Post("/rename", h.RenameHandler)
 	files.Delete("/delete", h.DeleteHandler)
 	files.Get("/view_archive", h.ArchiveHandler)
+	files.Post("/archive-download", h.ArchiveDownloadHandler)
+	files.Post("/compress", h.CompressHandler)
 	files.Post("/upload", h.UploadFileHandler)
 	files.Get("/view", h.ViewHandler)
 	files.Post("/save", h.SaveHandler)
 	files.Put("/permissions", h.UpdatePermissionsHandler)
 	files.Get("/download", h.DownloadHandler)
+	files.Get("/raw", h.RawHandler)
 	files.Get("/extract", h.ExtractorHandler)
 	files.Get("/make", h.MakeNewHandler)
+	files.Post("/copy", h.CopyHandler)
+	files.Post("/move", h.MoveHandler)
+	files.Get("/tasks", h.ListTasksHandler)
+	files.Get("/tasks/:id", h.GetTaskHandler)
+	files.Delete("/tasks/:id", h.CancelTaskHandler)
+	files.Get("/trash", h.TrashListHandler)
+	files.Post("/trash/restore", h.TrashRestoreHandler)
+	files.Delete("/trash", h.TrashEmptyHandler)
+	files.Post("/uploads", h.CreateUploadHandler)
+	files.Get("/uploads/:id", h.GetUploadHandler)
+	files.Put("/uploads/:id/:index", h.UploadChunkHandler)
+	files.Post("/uploads/:id/complete", h.CompleteUploadHandler)
+	files.Delete("/uploads/:id", h.AbortUploadHandler)
 }
 
 func setupStaticFileServing(app *fiber.App, useEmbeddedFiles bool) {
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"runs/internal/config"
+	"runs/internal/limiter"
+	"runs/internal/logger"
+	"runs/internal/models"
+	"runs/internal/notify"
+	"runs/internal/runner"
+	"runs/internal/utils"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/rs/zerolog"
+)
+
+const remoteTimeout = 15 * time.Minute
+
+// clientOptions are the flags shared by the list and exec subcommands
+type clientOptions struct {
+	configPath string
+	remote     string
+	token      string
+}
+
+func (o *clientOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.configPath, "config", defaultConfigFilePath, "path to the config file used in local mode")
+	flags.StringVar(&o.remote, "remote", "", "URL of a runs server, e.g. http://host:5678 (default: run locally)")
+	flags.StringVar(&o.token, "token", os.Getenv("RUNS_TOKEN"), "session token for the remote server (default $RUNS_TOKEN)")
+}
+
+// paramFlags collects repeated --param key=value flags
+type paramFlags map[string]string
+
+func (p paramFlags) String() string {
+	pairs := make([]string, 0, len(p))
+	for key, value := range p {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p paramFlags) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", pair)
+	}
+	p[key] = value
+	return nil
+}
+
+// listCommands prints the commands of the local config or the remote server
+func listCommands(args []string) error {
+	var opts clientOptions
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	opts.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var cfg *config.Config
+	if opts.remote != "" {
+		var commands []config.Command
+		if err := remoteRequest(opts, http.MethodGet, "/api/command/list", nil, &commands); err != nil {
+			return err
+		}
+		cfg = &config.Config{Commands: commands}
+	} else {
+		configManager, err := loadLocalConfig(opts.configPath)
+		if err != nil {
+			return err
+		}
+		cfg = configManager.GetConfig()
+	}
+
+	utils.DisplayCommands(cfg)
+	return nil
+}
+
+// execCommand runs a command locally or on the remote server and returns its exit code
+func execCommand(args []string) (int, error) {
+	var opts clientOptions
+	params := make(paramFlags)
+	flags := flag.NewFlagSet("exec", flag.ExitOnError)
+	opts.register(flags)
+	flags.Var(params, "param", "command parameter as key=value, can be repeated")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: runs exec <value> [--param key=value]... [--remote URL]")
+		flags.PrintDefaults()
+	}
+
+	// The value may come before or after the flags
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = append(args[1:], args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		return 1, err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2, errors.New("exactly one command value is required")
+	}
+	value := flags.Arg(0)
+
+	if opts.remote != "" {
+		return execRemote(opts, value, params)
+	}
+	return execLocal(opts, value, params)
+}
+
+func execLocal(opts clientOptions, value string, params paramFlags) (int, error) {
+	configManager, err := loadLocalConfig(opts.configPath)
+	if err != nil {
+		return 1, err
+	}
+
+	command, err := configManager.FindCommandByValue(value)
+	if err != nil {
+		return 1, err
+	}
+
+	// Commands run in their own process group, so forward interrupts by cancelling them
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Local runs are audited and notified like the ones the server starts
+	auditStore, err := openAuditStore(configManager.GetConfig().Audit)
+	if err != nil {
+		return 1, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if auditStore != nil {
+		defer auditStore.Close()
+	}
+	notifier := notify.New(configManager)
+	defer func() {
+		notifyCtx, cancel := context.WithTimeout(context.Background(), notifyShutdownTimeout)
+		defer cancel()
+		notifier.Close(notifyCtx)
+	}()
+
+	commandRunner := runner.New(configManager, auditStore, limiter.New(configManager), notifier)
+	req := runner.Request{
+		Value:   value,
+		Command: command,
+		Source:  runner.SourceCLI,
+		Timeout: jobTimeout,
+	}
+
+	if command.IsPipeline() {
+		steps, err := commandRunner.RunPipeline(ctx, req)
+		fmt.Println(runner.FormatSteps(steps))
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	if len(command.Params) > 0 {
+		rendered, err := command.Render(configManager.GetConfig().Paths, params)
+		if err != nil {
+			return 1, err
+		}
+		command.Command = rendered
+	}
+
+	output, err := commandRunner.Run(ctx, req)
+	var cmdErr *utils.CommandError
+	if errors.As(err, &cmdErr) {
+		output = cmdErr.Output
+	}
+	if output != "" {
+		fmt.Println(strings.TrimRight(output, "\n"))
+	}
+	if err != nil {
+		if exitCode := utils.ExitCode(err); exitCode > 0 {
+			return exitCode, err
+		}
+		return 1, err
+	}
+	return 0, nil
+}
+
+func execRemote(opts clientOptions, value string, params paramFlags) (int, error) {
+	form := url.Values{"value": {value}}
+	for key, paramValue := range params {
+		form.Set(key, paramValue)
+	}
+
+	var response models.Response
+	if err := remoteRequest(opts, http.MethodPost, "/api/command/execute", form, &response); err != nil {
+		return 1, err
+	}
+	fmt.Println(response.Message)
+	return 0, nil
+}
+
+// remoteRequest calls the API of a runs server and decodes the JSON response into out
+func remoteRequest(opts clientOptions, method, path string, form url.Values, out any) error {
+	endpoint := strings.TrimSuffix(opts.remote, "/") + path
+
+	req, err := http.NewRequest(method, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if opts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.token)
+	}
+
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", opts.remote, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var response models.Response
+		if err := sonic.ConfigDefault.NewDecoder(resp.Body).Decode(&response); err != nil || response.Message == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, response.Message)
+	}
+
+	if err := sonic.ConfigDefault.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// loadLocalConfig loads the config without the file watcher used by the server
+func loadLocalConfig(path string) (*config.ConfigManager, error) {
+	provider, err := config.NewProvider(path, *logger.GetLogger())
+	if err != nil {
+		return nil, err
+	}
+
+	configManager := config.NewConfigManager(provider, *logger.GetLogger())
+	if err := configManager.Load(context.Background()); err != nil {
+		return nil, err
+	}
+	return configManager, nil
+}
+
+// quietLogs keeps the CLI output readable by hiding the server's debug logs
+func quietLogs() {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+}
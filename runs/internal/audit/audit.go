@@ -0,0 +1,248 @@
+package audit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+)
+
+// Outcomes accepted by Filter.Outcome
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+const truncatedMarker = "\n[output truncated]"
+
+// maxLineSize bounds a single line read back from the log. Longer lines can
+// only come from an unlimited MaxOutput and are skipped by Query.
+const maxLineSize = 1024 * 1024
+
+// Entry records a single command execution
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+	User       string    `json:"user,omitempty"`
+	Value      string    `json:"value"`
+	Command    string    `json:"command"`
+	ExitCode   int       `json:"exitCode"`
+	DurationMs int64     `json:"durationMs"`
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output,omitempty"`
+}
+
+// Success reports whether the command ran and exited with code 0
+func (e *Entry) Success() bool {
+	return e.ExitCode == 0 && e.Error == ""
+}
+
+// Filter selects entries returned by Query. Zero fields match everything.
+type Filter struct {
+	Value   string
+	From    time.Time
+	To      time.Time
+	Outcome string
+	Limit   int
+}
+
+func (f *Filter) match(e *Entry) bool {
+	if f.Value != "" && e.Value != f.Value {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	switch f.Outcome {
+	case OutcomeSuccess:
+		return e.Success()
+	case OutcomeFailure:
+		return !e.Success()
+	}
+	return true
+}
+
+// Options configures a Store
+type Options struct {
+	Path       string
+	MaxSize    int64 // rotate once the file would grow beyond this many bytes
+	MaxBackups int   // number of rotated files to keep as Path.1 ... Path.N
+	MaxOutput  int   // bytes of command output kept per entry, 0 keeps all of it
+}
+
+// Store is an append-only audit log written as JSON lines with size-based rotation
+type Store struct {
+	opts Options
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens or creates the audit log at opts.Path
+func Open(opts Options) (*Store, error) {
+	s := &Store{opts: opts}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Record appends an entry to the log, truncating its output to MaxOutput bytes
+func (s *Store) Record(e Entry) error {
+	if s.opts.MaxOutput > 0 && len(e.Output) > s.opts.MaxOutput {
+		cut := s.opts.MaxOutput
+		for cut > 0 && !utf8.RuneStart(e.Output[cut]) {
+			cut--
+		}
+		e.Output = e.Output[:cut] + truncatedMarker
+	}
+
+	line, err := sonic.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.opts.MaxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.opts.MaxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotate audit log: %w", err)
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write audit entry: %w", err)
+	}
+	return nil
+}
+
+// Query returns the entries matching f, newest first
+func (s *Store) Query(f Filter) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []Entry
+	for i := s.opts.MaxBackups; i >= 0; i-- {
+		found, err := readEntries(s.backupPath(i), &f)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Time.After(entries[b].Time)
+	})
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+	return entries, nil
+}
+
+// Close closes the underlying file
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *Store) open() error {
+	file, err := os.OpenFile(s.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat audit log: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts Path.N-1 to Path.N, ..., Path to Path.1 and reopens Path.
+// Callers must hold s.mu.
+func (s *Store) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	if s.opts.MaxBackups <= 0 {
+		if err := os.Remove(s.opts.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return s.open()
+	}
+
+	for i := s.opts.MaxBackups - 1; i >= 0; i-- {
+		err := os.Rename(s.backupPath(i), s.backupPath(i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return s.open()
+}
+
+// backupPath returns the path of the i-th rotated file, with 0 being the live log
+func (s *Store) backupPath(i int) string {
+	if i == 0 {
+		return s.opts.Path
+	}
+	return fmt.Sprintf("%s.%d", s.opts.Path, i)
+}
+
+func readEntries(path string, f *Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	reader := bufio.NewReaderSize(file, maxLineSize)
+	oversized := false
+	for {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// Skip the rest of a line too long to keep in memory
+			oversized = true
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("read audit log %s: %w", path, err)
+		}
+
+		if oversized {
+			oversized = false
+		} else if len(line) > 0 {
+			var e Entry
+			// Lines torn by a crash mid-write fail to parse and are skipped
+			if sonic.Unmarshal(line, &e) == nil && f.match(&e) {
+				entries = append(entries, e)
+			}
+		}
+
+		if err != nil {
+			return entries, nil
+		}
+	}
+}
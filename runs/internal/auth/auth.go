@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"runs/internal/config"
+	"runs/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CookieName is the name of the session cookie set on login
+const CookieName = "runs_session"
+
+const sessionLocalsKey = "session"
+
+// ErrInvalidCredentials is returned when the username or password is wrong
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// dummyHash is compared against when the user does not exist, so that unknown
+// users take as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("runs"), bcrypt.DefaultCost)
+
+// Session is an authenticated login. Roles are resolved from the current
+// configuration on every request, so edits to [auth] apply to existing sessions.
+type Session struct {
+	Token     string    `json:"token,omitempty"`
+	User      string    `json:"user"`
+	Roles     []string  `json:"roles"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// HasAnyRole reports whether the session holds one of roles. An empty list
+// means the resource is open to every authenticated user.
+func (s *Session) HasAnyRole(roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range s.Roles {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRequiredRole reports whether the session holds one of roles. Unlike
+// HasAnyRole, an empty list lets nobody in.
+func (s *Session) HasRequiredRole(roles []string) bool {
+	return len(roles) > 0 && s.HasAnyRole(roles)
+}
+
+// Manager authenticates users from the [auth] section and keeps their sessions in memory
+type Manager struct {
+	configManager *config.ConfigManager
+	mu            sync.Mutex
+	sessions      map[string]Session
+}
+
+// NewManager creates a new Manager
+func NewManager(cm *config.ConfigManager) *Manager {
+	return &Manager{
+		configManager: cm,
+		sessions:      make(map[string]Session),
+	}
+}
+
+// Enabled reports whether authentication is switched on in the current configuration
+func (m *Manager) Enabled() bool {
+	return m.configManager.GetConfig().Auth.Enabled
+}
+
+// Login checks the credentials and starts a new session
+func (m *Manager) Login(username, password string) (Session, error) {
+	authConf := m.configManager.GetConfig().Auth
+
+	user, ok := authConf.Users[username]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return Session{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return Session{}, ErrInvalidCredentials
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return Session{}, err
+	}
+
+	session := Session{
+		Token:     token,
+		User:      user.Name,
+		Roles:     user.Roles,
+		ExpiresAt: time.Now().Add(authConf.SessionTTL),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purgeExpired()
+	m.sessions[token] = session
+
+	return session, nil
+}
+
+// Logout ends the session identified by token
+func (m *Manager) Logout(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, token)
+}
+
+// Middleware rejects requests without a valid session when authentication is
+// enabled. Requests to any of the public paths are let through.
+func (m *Manager) Middleware(publicPaths ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !m.Enabled() || slices.Contains(publicPaths, c.Path()) {
+			return c.Next()
+		}
+
+		session, ok := m.lookup(Token(c))
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(models.Response{Message: "Authentication required"})
+		}
+
+		c.Locals(sessionLocalsKey, session)
+		return c.Next()
+	}
+}
+
+// Token returns the session token sent as a bearer token or cookie
+func Token(c *fiber.Ctx) string {
+	if token := BearerToken(c); token != "" {
+		return token
+	}
+	return c.Cookies(CookieName)
+}
+
+// BearerToken returns the session token sent in the Authorization header. Unlike
+// the cookie, the browser never adds it to requests on its own.
+func BearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(header, "Bearer ")
+}
+
+// SessionFromCtx returns the session attached by Middleware, if any
+func SessionFromCtx(c *fiber.Ctx) (*Session, bool) {
+	session, ok := c.Locals(sessionLocalsKey).(*Session)
+	return session, ok
+}
+
+func (m *Manager) lookup(token string) (*Session, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	m.mu.Lock()
+	session, ok := m.sessions[token]
+	if ok && time.Now().After(session.ExpiresAt) {
+		delete(m.sessions, token)
+		ok = false
+	}
+	m.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	user, ok := m.configManager.GetConfig().Auth.Users[session.User]
+	if !ok {
+		return nil, false
+	}
+	session.Roles = user.Roles
+
+	return &session, true
+}
+
+// purgeExpired drops expired sessions. Callers must hold m.mu.
+func (m *Manager) purgeExpired() {
+	now := time.Now()
+	for token, session := range m.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(m.sessions, token)
+		}
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
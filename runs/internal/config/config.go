@@ -3,9 +3,13 @@ package config
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/rs/zerolog"
 	"gopkg.in/ini.v1"
@@ -18,23 +22,103 @@ type ConfigProvider interface {
 
 // Config structure
 type Config struct {
-	WebConf  WebConf
-	Paths    map[string]string
-	Commands []Command
+	WebConf   WebConf
+	Auth      AuthConf
+	Audit     AuditConf
+	Limits    LimitsConf
+	Notifiers map[string]Notifier // keyed by name
+	Paths     map[string]string
+	Commands  []Command
 }
 
 // WebConf structure
 type WebConf struct {
-	Port        string
-	RestrictDir bool
+	Port         string
+	RestrictDir  bool
+	AllowCustom  bool
+	AllowOrigins string
+	// ShutdownGrace is how long running commands may finish before they are killed on shutdown
+	ShutdownGrace time.Duration
+	// PublicMetrics serves /metrics without a session when auth is enabled
+	PublicMetrics bool
 }
 
-// Command structure
+// AuthConf structure
+type AuthConf struct {
+	Enabled     bool
+	SessionTTL  time.Duration
+	CustomRoles []string
+	AuditRoles  []string
+	Users       map[string]User
+}
+
+// AuditConf structure
+type AuditConf struct {
+	Enabled    bool
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxOutput  int
+}
+
+// Lock modes decide what happens to a command that can't start right away
+const (
+	LockModeQueue  = "queue"
+	LockModeReject = "reject"
+)
+
+// LimitsConf structure
+type LimitsConf struct {
+	MaxConcurrent int
+	LockMode      string
+	QueueTimeout  time.Duration
+	// MaxOutput caps the captured output of commands that don't set their own cap
+	MaxOutput int64
+}
+
+// User structure
+type User struct {
+	Name         string
+	PasswordHash string
+	Roles        []string
+}
+
+// Shells a command can be executed with. An empty Shell picks one based on the OS.
+const (
+	ShellSh   = "sh"
+	ShellBash = "bash"
+	ShellSu   = "su"
+	ShellNone = "none"
+)
+
+// Command structure. Command holds the rendered command line, or the raw
+// template when the command declares Params; see Render.
 type Command struct {
 	Name        string
 	Value       string
 	Command     string
 	Description string
+	Timeout     time.Duration
+	WorkDir     string
+	Env         []string
+	Shell       string
+	RunAs       string
+	Roles       []string
+	Schedule    string
+	Lock        string
+	MaxOutput   int64
+	LimitCPU    time.Duration
+	LimitMemory int64
+	Notify      []string
+	NotifyOn    []string
+	// Output and Extract turn the command output into structured data
+	Output  string
+	Extract string
+	Params  []Param
+	Steps   []Step
+
+	rawCommand string
+	extract    *regexp.Regexp
 }
 
 // FileConfigProvider implements ConfigProvider for INI files
@@ -53,44 +137,84 @@ func NewFileConfigProvider(filePath string, logger zerolog.Logger) *FileConfigPr
 
 // Load implements ConfigProvider.Load for INI files
 func (fcp *FileConfigProvider) Load(ctx context.Context) (*Config, error) {
+	doc, err := fcp.loadDocument()
+	if err != nil {
+		return nil, err
+	}
+	return doc.build()
+}
+
+func (fcp *FileConfigProvider) loadDocument() (*document, error) {
 	cfg, err := ini.LoadSources(ini.LoadOptions{AllowBooleanKeys: true}, fcp.FilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config file: %w", err)
 	}
 
-	config := &Config{
-		WebConf: WebConf{
-			Port:        cfg.Section("webconf").Key("port").MustString(":8080"),
-			RestrictDir: cfg.Section("webconf").Key("restrictDir").MustBool(false),
-		},
-		Paths:    make(map[string]string),
-		Commands: []Command{},
+	doc := defaultDocument()
+	doc.WebConf = webConfDocument{
+		Port:          cfg.Section("webconf").Key("port").MustString(doc.WebConf.Port),
+		RestrictDir:   cfg.Section("webconf").Key("restrictDir").MustBool(doc.WebConf.RestrictDir),
+		AllowCustom:   cfg.Section("webconf").Key("allowCustom").MustBool(doc.WebConf.AllowCustom),
+		AllowOrigins:  cfg.Section("webconf").Key("allowOrigins").MustString(doc.WebConf.AllowOrigins),
+		ShutdownGrace: cfg.Section("webconf").Key("shutdownGrace").MustString(doc.WebConf.ShutdownGrace),
+		PublicMetrics: cfg.Section("webconf").Key("publicMetrics").MustBool(doc.WebConf.PublicMetrics),
+	}
+	doc.Audit = auditDocument{
+		Enabled:    cfg.Section("audit").Key("enabled").MustBool(doc.Audit.Enabled),
+		File:       cfg.Section("audit").Key("file").MustString(doc.Audit.File),
+		MaxSizeMB:  cfg.Section("audit").Key("maxSizeMB").MustInt(doc.Audit.MaxSizeMB),
+		MaxBackups: cfg.Section("audit").Key("maxBackups").MustInt(doc.Audit.MaxBackups),
+		MaxOutput:  cfg.Section("audit").Key("maxOutput").MustInt(doc.Audit.MaxOutput),
 	}
 
-	if err := parsePaths(cfg, config); err != nil {
-		return nil, fmt.Errorf("failed to parse paths: %w", err)
+	doc.Limits = limitsDocument{
+		MaxConcurrent: cfg.Section("limits").Key("maxConcurrent").MustInt(doc.Limits.MaxConcurrent),
+		LockMode:      cfg.Section("limits").Key("lockMode").MustString(doc.Limits.LockMode),
+		QueueTimeout:  cfg.Section("limits").Key("queueTimeout").MustString(doc.Limits.QueueTimeout),
+		MaxOutput:     cfg.Section("limits").Key("maxOutput").MustString(doc.Limits.MaxOutput),
 	}
 
-	if err := parseCommands(cfg, config); err != nil {
+	parseAuth(cfg, doc)
+	parsePaths(cfg, doc)
+	doc.Notifiers = parseNotifiers(cfg)
+
+	if err := parseCommands(cfg, doc); err != nil {
 		return nil, fmt.Errorf("failed to parse commands: %w", err)
 	}
 
-	return config, nil
+	return doc, nil
 }
 
-func parsePaths(cfg *ini.File, config *Config) error {
-	pathsSection := cfg.Section("paths")
-	for _, key := range pathsSection.Keys() {
-		if key.Name() != "" && key.String() != "" {
-			config.Paths[key.Name()] = key.String()
-		} else {
-			return fmt.Errorf("invalid path entry in [paths] section: key=%s, value=%s", key.Name(), key.String())
+func parseAuth(cfg *ini.File, doc *document) {
+	authSection := cfg.Section("auth")
+	doc.Auth = authDocument{
+		Enabled:     authSection.Key("enabled").MustBool(doc.Auth.Enabled),
+		SessionTTL:  authSection.Key("sessionTTL").MustString(doc.Auth.SessionTTL),
+		CustomRoles: authSection.Key("customRoles").Strings(","),
+		AuditRoles:  authSection.Key("auditRoles").Strings(","),
+	}
+
+	for _, key := range authSection.Keys() {
+		if !strings.HasSuffix(key.Name(), "Password") {
+			continue
 		}
+
+		name := strings.TrimSuffix(key.Name(), "Password")
+		doc.Auth.Users = append(doc.Auth.Users, userDocument{
+			Name:     name,
+			Password: key.String(),
+			Roles:    authSection.Key(name + "Roles").Strings(","),
+		})
+	}
+}
+
+func parsePaths(cfg *ini.File, doc *document) {
+	for _, key := range cfg.Section("paths").Keys() {
+		doc.Paths[key.Name()] = key.String()
 	}
-	return nil
 }
 
-func parseCommands(cfg *ini.File, config *Config) error {
+func parseCommands(cfg *ini.File, doc *document) error {
 	commandsSection := cfg.Section("commands")
 	for _, key := range commandsSection.Keys() {
 		if key.Name() == "" || len(key.Name()) < 4 || key.Name()[len(key.Name())-4:] != "Name" {
@@ -98,24 +222,44 @@ func parseCommands(cfg *ini.File, config *Config) error {
 		}
 		
 		baseName := key.Name()[:len(key.Name())-4]
-		command := Command{
+		command := commandDocument{
 			Name:        key.String(),
 			Value:       commandsSection.Key(baseName + "Value").String(),
-			Command:     replacePlaceholders(commandsSection.Key(baseName + "Command").String(), config.Paths),
+			Command:     commandsSection.Key(baseName + "Command").String(),
 			Description: commandsSection.Key(baseName + "Description").String(),
+			Timeout:     commandsSection.Key(baseName + "Timeout").String(),
+			WorkDir:     commandsSection.Key(baseName + "WorkDir").String(),
+			Env:         commandsSection.Key(baseName + "Env").Strings(","),
+			Shell:       commandsSection.Key(baseName + "Shell").String(),
+			RunAs:       commandsSection.Key(baseName + "RunAs").String(),
+			Roles:       commandsSection.Key(baseName + "Roles").Strings(","),
+			Schedule:    commandsSection.Key(baseName + "Schedule").String(),
+			Lock:        commandsSection.Key(baseName + "Lock").String(),
+			MaxOutput:   commandsSection.Key(baseName + "MaxOutput").String(),
+			LimitCPU:    commandsSection.Key(baseName + "LimitCPU").String(),
+			LimitMemory: commandsSection.Key(baseName + "LimitMemory").String(),
+			Notify:      commandsSection.Key(baseName + "Notify").Strings(","),
+			NotifyOn:    commandsSection.Key(baseName + "NotifyOn").Strings(","),
+			Output:      commandsSection.Key(baseName + "Output").String(),
+			Extract:     commandsSection.Key(baseName + "Extract").String(),
+			Params:      parseParams(cfg, baseName),
 		}
 		
-		if command.Name == "" || command.Value == "" || command.Command == "" {
-			return fmt.Errorf("invalid command entry for: %s", baseName)
+		steps, err := parseSteps(commandsSection.Key(baseName + "Steps").String())
+		if err != nil {
+			return fmt.Errorf("invalid steps for %s: %w", baseName, err)
 		}
+		command.Steps = steps
 		
-		config.Commands = append(config.Commands, command)
+		doc.Commands = append(doc.Commands, command)
 	}
 	return nil
 }
 
+// replacePlaceholders renders the [paths] placeholders of command. It returns the
+// command unchanged if it can't be rendered; Validate reports why.
 func replacePlaceholders(command string, paths map[string]string) string {
-	tmpl, err := template.New("command").Parse(command)
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(command)
 	if err != nil {
 		return command
 	}
@@ -129,10 +273,22 @@ func replacePlaceholders(command string, paths map[string]string) string {
 	return buf.String()
 }
 
+// LoadStatus describes the outcome of the most recent configuration loads
+type LoadStatus struct {
+	LastLoad    time.Time `json:"lastLoad"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	Errors      []string  `json:"errors,omitempty"`
+	Warnings    []string  `json:"warnings,omitempty"`
+	Added       []string  `json:"added,omitempty"`
+	Removed     []string  `json:"removed,omitempty"`
+	Changed     []string  `json:"changed,omitempty"`
+}
+
 // ConfigManager manages the configuration
 type ConfigManager struct {
 	provider ConfigProvider
 	config   *Config
+	status   LoadStatus
 	mu       sync.RWMutex
 	logger   zerolog.Logger
 }
@@ -145,20 +301,51 @@ func NewConfigManager(provider ConfigProvider, logger zerolog.Logger) *ConfigMan
 	}
 }
 
-// Load loads the configuration
+// Load loads and validates the configuration. If loading or validation fails the
+// previously loaded configuration stays active.
 func (cm *ConfigManager) Load(ctx context.Context) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	now := time.Now()
+	cm.status.LastAttempt = now
+
 	config, err := cm.provider.Load(ctx)
 	if err != nil {
+		cm.status.Errors = []string{err.Error()}
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
+	errs, warnings := Validate(config, cm.config)
+	cm.status.Warnings = warnings
+	if len(errs) > 0 {
+		cm.status.Errors = make([]string, len(errs))
+		for i, err := range errs {
+			cm.status.Errors[i] = err.Error()
+		}
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+
+	for _, warning := range warnings {
+		cm.logger.Warn().Msg(warning)
+	}
+
+	cm.status.Errors = nil
+	cm.status.LastLoad = now
+	if cm.config != nil {
+		cm.status.Added, cm.status.Removed, cm.status.Changed = diffCommands(cm.config.Commands, config.Commands)
+	}
 	cm.config = config
 	return nil
 }
 
+// Status returns the outcome of the most recent loads
+func (cm *ConfigManager) Status() LoadStatus {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.status
+}
+
 // GetConfig returns the current configuration
 func (cm *ConfigManager) GetConfig() *Config {
 	cm.mu.RLock()
@@ -188,6 +375,8 @@ func (cm *ConfigManager) LogConfig() {
 	cm.logger.Info().
 		Str("port", cm.config.WebConf.Port).
 		Bool("restrictDir", cm.config.WebConf.RestrictDir).
+		Bool("allowCustom", cm.config.WebConf.AllowCustom).
+		Bool("auth", cm.config.Auth.Enabled).
 		Interface("paths", cm.config.Paths).
 		Interface("commands", cm.config.Commands).
 		Msg("Configuration loaded")
@@ -0,0 +1,404 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// document is the provider-neutral form of a configuration file. Every provider
+// decodes into a document, and build turns it into a validated Config, so all
+// file formats share the same defaults and rules.
+type document struct {
+	WebConf   webConfDocument    `json:"webconf" yaml:"webconf"`
+	Auth      authDocument       `json:"auth" yaml:"auth"`
+	Audit     auditDocument      `json:"audit" yaml:"audit"`
+	Limits    limitsDocument     `json:"limits" yaml:"limits"`
+	Notifiers []notifierDocument `json:"notifiers,omitempty" yaml:"notifiers,omitempty"`
+	Paths     map[string]string  `json:"paths" yaml:"paths"`
+	Commands  []commandDocument  `json:"commands" yaml:"commands"`
+}
+
+type webConfDocument struct {
+	Port          string `json:"port" yaml:"port"`
+	RestrictDir   bool   `json:"restrictDir" yaml:"restrictDir"`
+	AllowCustom   bool   `json:"allowCustom" yaml:"allowCustom"`
+	AllowOrigins  string `json:"allowOrigins" yaml:"allowOrigins"`
+	ShutdownGrace string `json:"shutdownGrace" yaml:"shutdownGrace"`
+	PublicMetrics bool   `json:"publicMetrics" yaml:"publicMetrics"`
+}
+
+type authDocument struct {
+	Enabled     bool           `json:"enabled" yaml:"enabled"`
+	SessionTTL  string         `json:"sessionTTL" yaml:"sessionTTL"`
+	CustomRoles []string       `json:"customRoles,omitempty" yaml:"customRoles,omitempty"`
+	AuditRoles  []string       `json:"auditRoles,omitempty" yaml:"auditRoles,omitempty"`
+	Users       []userDocument `json:"users,omitempty" yaml:"users,omitempty"`
+}
+
+type userDocument struct {
+	Name     string   `json:"name" yaml:"name"`
+	Password string   `json:"password" yaml:"password"`
+	Roles    []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+type auditDocument struct {
+	Enabled    bool   `json:"enabled" yaml:"enabled"`
+	File       string `json:"file" yaml:"file"`
+	MaxSizeMB  int    `json:"maxSizeMB" yaml:"maxSizeMB"`
+	MaxBackups int    `json:"maxBackups" yaml:"maxBackups"`
+	MaxOutput  int    `json:"maxOutput" yaml:"maxOutput"`
+}
+
+type limitsDocument struct {
+	MaxConcurrent int    `json:"maxConcurrent" yaml:"maxConcurrent"`
+	LockMode      string `json:"lockMode" yaml:"lockMode"`
+	QueueTimeout  string `json:"queueTimeout" yaml:"queueTimeout"`
+	MaxOutput     string `json:"maxOutput" yaml:"maxOutput"`
+}
+
+type commandDocument struct {
+	Name        string          `json:"name" yaml:"name"`
+	Value       string          `json:"value" yaml:"value"`
+	Command     string          `json:"command,omitempty" yaml:"command,omitempty"`
+	Description string          `json:"description,omitempty" yaml:"description,omitempty"`
+	Timeout     string          `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	WorkDir     string          `json:"workDir,omitempty" yaml:"workDir,omitempty"`
+	Env         []string        `json:"env,omitempty" yaml:"env,omitempty"`
+	Shell       string          `json:"shell,omitempty" yaml:"shell,omitempty"`
+	RunAs       string          `json:"runAs,omitempty" yaml:"runAs,omitempty"`
+	Roles       []string        `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Schedule    string          `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Lock        string          `json:"lock,omitempty" yaml:"lock,omitempty"`
+	MaxOutput   string          `json:"maxOutput,omitempty" yaml:"maxOutput,omitempty"`
+	LimitCPU    string          `json:"limitCPU,omitempty" yaml:"limitCPU,omitempty"`
+	LimitMemory string          `json:"limitMemory,omitempty" yaml:"limitMemory,omitempty"`
+	Notify      []string        `json:"notify,omitempty" yaml:"notify,omitempty"`
+	NotifyOn    []string        `json:"notifyOn,omitempty" yaml:"notifyOn,omitempty"`
+	Output      string          `json:"output,omitempty" yaml:"output,omitempty"`
+	Extract     string          `json:"extract,omitempty" yaml:"extract,omitempty"`
+	Params      []paramDocument `json:"params,omitempty" yaml:"params,omitempty"`
+	Steps       []stepDocument  `json:"steps,omitempty" yaml:"steps,omitempty"`
+}
+
+type notifierDocument struct {
+	Name     string `json:"name" yaml:"name"`
+	Type     string `json:"type" yaml:"type"`
+	URL      string `json:"url,omitempty" yaml:"url,omitempty"`
+	Body     string `json:"body,omitempty" yaml:"body,omitempty"`
+	BotToken string `json:"botToken,omitempty" yaml:"botToken,omitempty"`
+	ChatID   string `json:"chatId,omitempty" yaml:"chatId,omitempty"`
+	Message  string `json:"message,omitempty" yaml:"message,omitempty"`
+	Script   string `json:"script,omitempty" yaml:"script,omitempty"`
+	Retries  *int   `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Timeout  string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// MaxOutput is a size such as 4K, unset uses the default and 0 means no cap
+	MaxOutput string `json:"maxOutput,omitempty" yaml:"maxOutput,omitempty"`
+}
+
+type paramDocument struct {
+	Name        string   `json:"name" yaml:"name"`
+	Type        string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Regex       string   `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Default     string   `json:"default,omitempty" yaml:"default,omitempty"`
+	Options     []string `json:"options,omitempty" yaml:"options,omitempty"`
+	Required    bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+type stepDocument struct {
+	Value     string `json:"value" yaml:"value"`
+	OnFailure string `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
+	Output    string `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// defaultDocument returns a document holding the default of every setting.
+// Providers decode on top of it, so keys missing from a file keep their default.
+func defaultDocument() *document {
+	return &document{
+		WebConf: webConfDocument{
+			Port:          ":8080",
+			AllowCustom:   true,
+			AllowOrigins:  "*",
+			ShutdownGrace: "30s",
+		},
+		Auth: authDocument{
+			SessionTTL: "12h",
+		},
+		Audit: auditDocument{
+			Enabled:    true,
+			File:       "./audit.log",
+			MaxSizeMB:  10,
+			MaxBackups: 5,
+			MaxOutput:  4096,
+		},
+		Limits: limitsDocument{
+			LockMode:     LockModeQueue,
+			QueueTimeout: "1m",
+			MaxOutput:    "1M",
+		},
+		Paths: make(map[string]string),
+	}
+}
+
+// build validates the document and converts it into a Config
+func (d *document) build() (*Config, error) {
+	config := &Config{
+		WebConf: WebConf{
+			Port:          d.WebConf.Port,
+			RestrictDir:   d.WebConf.RestrictDir,
+			AllowCustom:   d.WebConf.AllowCustom,
+			AllowOrigins:  d.WebConf.AllowOrigins,
+			PublicMetrics: d.WebConf.PublicMetrics,
+		},
+		Audit: AuditConf{
+			Enabled:    d.Audit.Enabled,
+			File:       d.Audit.File,
+			MaxSizeMB:  d.Audit.MaxSizeMB,
+			MaxBackups: d.Audit.MaxBackups,
+			MaxOutput:  d.Audit.MaxOutput,
+		},
+		Paths:    make(map[string]string),
+		Commands: []Command{},
+	}
+
+	if d.WebConf.ShutdownGrace != "" {
+		grace, err := time.ParseDuration(d.WebConf.ShutdownGrace)
+		if err != nil || grace < 0 {
+			return nil, fmt.Errorf("invalid shutdownGrace %q", d.WebConf.ShutdownGrace)
+		}
+		config.WebConf.ShutdownGrace = grace
+	}
+
+	if err := d.buildAuth(config); err != nil {
+		return nil, fmt.Errorf("failed to parse auth: %w", err)
+	}
+
+	if err := d.buildLimits(config); err != nil {
+		return nil, fmt.Errorf("failed to parse limits: %w", err)
+	}
+
+	for name, path := range d.Paths {
+		if name == "" || path == "" {
+			return nil, fmt.Errorf("failed to parse paths: invalid path entry: key=%s, value=%s", name, path)
+		}
+		config.Paths[name] = path
+	}
+
+	notifiers, err := buildNotifiers(d.Notifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notifiers: %w", err)
+	}
+	config.Notifiers = notifiers
+
+	for i := range d.Commands {
+		command, err := d.Commands[i].build(config.Paths, config.Notifiers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse commands: %w", err)
+		}
+		config.Commands = append(config.Commands, command)
+	}
+
+	if err := validateSteps(config.Commands); err != nil {
+		return nil, fmt.Errorf("failed to parse commands: %w", err)
+	}
+
+	return config, nil
+}
+
+func (d *document) buildAuth(config *Config) error {
+	sessionTTL, err := time.ParseDuration(d.Auth.SessionTTL)
+	if err != nil || sessionTTL <= 0 {
+		return fmt.Errorf("invalid sessionTTL %q", d.Auth.SessionTTL)
+	}
+
+	config.Auth = AuthConf{
+		Enabled:     d.Auth.Enabled,
+		SessionTTL:  sessionTTL,
+		CustomRoles: d.Auth.CustomRoles,
+		AuditRoles:  d.Auth.AuditRoles,
+		Users:       make(map[string]User, len(d.Auth.Users)),
+	}
+
+	for _, user := range d.Auth.Users {
+		if user.Name == "" || user.Password == "" {
+			return fmt.Errorf("invalid user entry: %q", user.Name)
+		}
+		if _, ok := config.Auth.Users[user.Name]; ok {
+			return fmt.Errorf("duplicate user %q", user.Name)
+		}
+		config.Auth.Users[user.Name] = User{
+			Name:         user.Name,
+			PasswordHash: user.Password,
+			Roles:        user.Roles,
+		}
+	}
+
+	if config.Auth.Enabled && len(config.Auth.Users) == 0 {
+		return fmt.Errorf("auth is enabled but no users are defined")
+	}
+
+	return nil
+}
+
+func (d *document) buildLimits(config *Config) error {
+	config.Limits = LimitsConf{
+		MaxConcurrent: d.Limits.MaxConcurrent,
+		LockMode:      d.Limits.LockMode,
+	}
+
+	if config.Limits.MaxConcurrent < 0 {
+		return fmt.Errorf("maxConcurrent can't be negative")
+	}
+
+	if config.Limits.LockMode != LockModeQueue && config.Limits.LockMode != LockModeReject {
+		return fmt.Errorf("lockMode must be %s or %s", LockModeQueue, LockModeReject)
+	}
+
+	if d.Limits.QueueTimeout != "" {
+		timeout, err := time.ParseDuration(d.Limits.QueueTimeout)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid queueTimeout %q", d.Limits.QueueTimeout)
+		}
+		config.Limits.QueueTimeout = timeout
+	}
+
+	maxOutput, err := ParseSize(d.Limits.MaxOutput)
+	if err != nil {
+		return fmt.Errorf("invalid maxOutput: %w", err)
+	}
+	config.Limits.MaxOutput = maxOutput
+
+	return nil
+}
+
+// build validates a command and renders its [paths] placeholders
+func (cd *commandDocument) build(paths map[string]string, notifiers map[string]Notifier) (Command, error) {
+	id := cd.Value
+	if id == "" {
+		id = cd.Name
+	}
+
+	command := Command{
+		Name:        cd.Name,
+		Value:       cd.Value,
+		Command:     replacePlaceholders(cd.Command, paths),
+		Description: cd.Description,
+		WorkDir:     replacePlaceholders(cd.WorkDir, paths),
+		Env:         cd.Env,
+		Shell:       cd.Shell,
+		RunAs:       cd.RunAs,
+		Roles:       cd.Roles,
+		Schedule:    cd.Schedule,
+		Lock:        cd.Lock,
+		rawCommand:  cd.Command,
+	}
+
+	steps, err := buildSteps(cd.Steps)
+	if err != nil {
+		return Command{}, fmt.Errorf("invalid steps for %s: %w", id, err)
+	}
+	command.Steps = steps
+
+	if command.Name == "" || command.Value == "" || (command.Command == "" && !command.IsPipeline()) {
+		return Command{}, fmt.Errorf("invalid command entry for: %s", id)
+	}
+
+	if command.Command != "" && command.IsPipeline() {
+		return Command{}, fmt.Errorf("invalid command entry for %s: a pipeline can't have its own command", id)
+	}
+
+	if command.Lock != "" && command.IsPipeline() {
+		return Command{}, fmt.Errorf("invalid command entry for %s: a pipeline can't take a lock, its steps take their own", id)
+	}
+
+	if err := cd.buildExecSettings(&command); err != nil {
+		return Command{}, fmt.Errorf("invalid command entry for %s: %w", id, err)
+	}
+
+	if err := cd.buildNotify(&command, notifiers); err != nil {
+		return Command{}, fmt.Errorf("invalid command entry for %s: %w", id, err)
+	}
+
+	if err := cd.buildOutput(&command); err != nil {
+		return Command{}, fmt.Errorf("invalid command entry for %s: %w", id, err)
+	}
+
+	params, err := buildParams(cd.Params, paths)
+	if err != nil {
+		return Command{}, fmt.Errorf("invalid parameters for %s: %w", id, err)
+	}
+	if len(params) > 0 && usesCmd(command.Shell) {
+		return Command{}, fmt.Errorf("invalid parameters for %s: cmd.exe has no quoting that makes parameters safe, pick another shell", id)
+	}
+	if len(params) > 0 {
+		// Parameters are only known per request, so rendering waits until then
+		command.Params = params
+		command.Command = cd.Command
+	}
+
+	return command, nil
+}
+
+// buildExecSettings validates the optional execution settings of a command
+func (cd *commandDocument) buildExecSettings(command *Command) error {
+	if cd.Timeout != "" {
+		timeout, err := time.ParseDuration(cd.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", cd.Timeout, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive: %s", cd.Timeout)
+		}
+		command.Timeout = timeout
+	}
+
+	switch command.Shell {
+	case "", ShellSh, ShellBash, ShellSu, ShellNone:
+	default:
+		return fmt.Errorf("unknown shell %q", command.Shell)
+	}
+
+	if command.Schedule != "" {
+		if _, err := cron.ParseStandard(command.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule %q: %w", command.Schedule, err)
+		}
+	}
+
+	for _, env := range command.Env {
+		if !strings.Contains(env, "=") {
+			return fmt.Errorf("invalid env entry %q, expected KEY=VALUE", env)
+		}
+	}
+
+	return cd.buildResourceLimits(command)
+}
+
+// buildResourceLimits validates the output cap and rlimits of a command
+func (cd *commandDocument) buildResourceLimits(command *Command) error {
+	var err error
+	if command.MaxOutput, err = ParseSize(cd.MaxOutput); err != nil {
+		return fmt.Errorf("invalid maxOutput: %w", err)
+	}
+
+	if cd.LimitCPU != "" {
+		limit, err := time.ParseDuration(cd.LimitCPU)
+		if err != nil || limit < time.Second {
+			return fmt.Errorf("invalid limitCPU %q, expected a duration of at least 1s", cd.LimitCPU)
+		}
+		command.LimitCPU = limit
+	}
+
+	if command.LimitMemory, err = ParseSize(cd.LimitMemory); err != nil {
+		return fmt.Errorf("invalid limitMemory: %w", err)
+	}
+
+	// rlimits are applied by the shell, there is none to apply them without one
+	if (command.LimitCPU > 0 || command.LimitMemory > 0) && command.Shell == ShellNone {
+		return fmt.Errorf("resource limits need a shell, %s runs the command directly", ShellNone)
+	}
+
+	return nil
+}
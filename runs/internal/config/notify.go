@@ -0,0 +1,205 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// Notifier types
+const (
+	NotifierWebhook  = "webhook"
+	NotifierTelegram = "telegram"
+	NotifierScript   = "script"
+)
+
+// Outcomes a command can notify on
+const (
+	NotifyOnSuccess = "success"
+	NotifyOnFailure = "failure"
+	NotifyOnTimeout = "timeout"
+)
+
+// notifierSectionPrefix starts the name of every notifier section,
+// e.g. [notify.ops] declares the "ops" notifier
+const notifierSectionPrefix = "notify."
+
+const (
+	defaultNotifyRetries   = 3
+	defaultNotifyTimeout   = 10 * time.Second
+	defaultNotifyMaxOutput = 4096
+)
+
+// Notifier is a destination for command completion notifications
+type Notifier struct {
+	Name string
+	Type string
+	// URL and Body configure a webhook, Body is a template producing JSON
+	URL  string
+	Body string
+	// BotToken, ChatID and Message configure a Telegram bot, Message is a text template
+	BotToken string
+	ChatID   string
+	Message  string
+	// Script is run with the event as JSON on stdin
+	Script  string
+	Retries int
+	Timeout time.Duration
+	// MaxOutput caps the command output sent in bytes, 0 means no cap
+	MaxOutput int64
+}
+
+// NotifyTemplateFuncs are available in notifier templates. json encodes a value,
+// so {{json .Output}} is always a valid JSON string.
+var NotifyTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Template parses the body or message template of the notifier. It returns nil
+// when the notifier has none and the default format applies.
+func (n *Notifier) Template() (*template.Template, error) {
+	text := n.Body
+	if n.Type == NotifierTelegram {
+		text = n.Message
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(n.Name).Funcs(NotifyTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// parseNotifiers reads the [notify.<name>] sections
+func parseNotifiers(cfg *ini.File) []notifierDocument {
+	var notifiers []notifierDocument
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section.Name(), notifierSectionPrefix) {
+			continue
+		}
+
+		doc := notifierDocument{
+			Name:     strings.TrimPrefix(section.Name(), notifierSectionPrefix),
+			Type:     section.Key("type").String(),
+			URL:      section.Key("url").String(),
+			Body:     section.Key("body").String(),
+			BotToken: section.Key("botToken").String(),
+			ChatID:   section.Key("chatId").String(),
+			Message:  section.Key("message").String(),
+			Script:   section.Key("script").String(),
+			Timeout:  section.Key("timeout").String(),
+		}
+		doc.MaxOutput = section.Key("maxOutput").String()
+		if section.HasKey("retries") {
+			retries := section.Key("retries").MustInt(-1)
+			doc.Retries = &retries
+		}
+		notifiers = append(notifiers, doc)
+	}
+	return notifiers
+}
+
+// buildNotifiers validates notifier declarations
+func buildNotifiers(docs []notifierDocument) (map[string]Notifier, error) {
+	notifiers := make(map[string]Notifier, len(docs))
+	for _, doc := range docs {
+		n := Notifier{
+			Name:     doc.Name,
+			Type:     doc.Type,
+			URL:      doc.URL,
+			Body:     doc.Body,
+			BotToken: doc.BotToken,
+			ChatID:   doc.ChatID,
+			Message:  doc.Message,
+			Script:   doc.Script,
+			Retries:  defaultNotifyRetries,
+			Timeout:  defaultNotifyTimeout,
+		}
+		if doc.Retries != nil {
+			n.Retries = *doc.Retries
+		}
+
+		if n.Name == "" {
+			return nil, fmt.Errorf("notifier without a name")
+		}
+		if _, ok := notifiers[n.Name]; ok {
+			return nil, fmt.Errorf("duplicate notifier %q", n.Name)
+		}
+
+		switch n.Type {
+		case NotifierWebhook:
+			if n.URL == "" {
+				return nil, fmt.Errorf("notifier %s: webhook needs a url", n.Name)
+			}
+		case NotifierTelegram:
+			if n.BotToken == "" || n.ChatID == "" {
+				return nil, fmt.Errorf("notifier %s: telegram needs a botToken and a chatId", n.Name)
+			}
+		case NotifierScript:
+			if n.Script == "" {
+				return nil, fmt.Errorf("notifier %s: script needs a script path", n.Name)
+			}
+		default:
+			return nil, fmt.Errorf("notifier %s: unknown type %q", n.Name, n.Type)
+		}
+
+		if n.Retries < 0 {
+			return nil, fmt.Errorf("notifier %s: retries can't be negative", n.Name)
+		}
+		if doc.Timeout != "" {
+			timeout, err := time.ParseDuration(doc.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("notifier %s: invalid timeout %q", n.Name, doc.Timeout)
+			}
+			n.Timeout = timeout
+		}
+		n.MaxOutput = defaultNotifyMaxOutput
+		if doc.MaxOutput != "" {
+			maxOutput, err := ParseSize(doc.MaxOutput)
+			if err != nil {
+				return nil, fmt.Errorf("notifier %s: invalid maxOutput: %w", n.Name, err)
+			}
+			n.MaxOutput = maxOutput
+		}
+		if _, err := n.Template(); err != nil {
+			return nil, fmt.Errorf("notifier %s: invalid template: %w", n.Name, err)
+		}
+
+		notifiers[n.Name] = n
+	}
+	return notifiers, nil
+}
+
+// buildNotify validates the notifiers and outcomes a command notifies on
+func (cd *commandDocument) buildNotify(command *Command, notifiers map[string]Notifier) error {
+	for _, name := range cd.Notify {
+		if _, ok := notifiers[name]; !ok {
+			return fmt.Errorf("unknown notifier %q", name)
+		}
+	}
+	command.Notify = cd.Notify
+
+	command.NotifyOn = cd.NotifyOn
+	if len(command.Notify) > 0 && len(command.NotifyOn) == 0 {
+		command.NotifyOn = []string{NotifyOnSuccess, NotifyOnFailure, NotifyOnTimeout}
+	}
+	for _, outcome := range command.NotifyOn {
+		switch outcome {
+		case NotifyOnSuccess, NotifyOnFailure, NotifyOnTimeout:
+		default:
+			return fmt.Errorf("unknown notify outcome %q", outcome)
+		}
+	}
+	return nil
+}
+
+// NotifiesOn reports whether the command sends notifications for the outcome
+func (c *Command) NotifiesOn(outcome string) bool {
+	return len(c.Notify) > 0 && slices.Contains(c.NotifyOn, outcome)
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// Output formats a command can declare with <base>Output
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// HasStructuredOutput reports whether the output of the command is parsed into data
+func (c *Command) HasStructuredOutput() bool {
+	return c.Output == OutputJSON || c.extract != nil
+}
+
+// ParseOutput turns the output of the command into structured data. JSON output
+// is decoded as is. An Extract pattern yields one object per match, holding the
+// text of each named group.
+func (c *Command) ParseOutput(output string) (any, error) {
+	if c.Output == OutputJSON {
+		var data any
+		if err := json.Unmarshal([]byte(output), &data); err != nil {
+			return nil, fmt.Errorf("output of %s is not valid JSON: %w", c.Value, err)
+		}
+		return data, nil
+	}
+
+	if c.extract == nil {
+		return nil, nil
+	}
+
+	names := c.extract.SubexpNames()
+	matches := c.extract.FindAllStringSubmatch(output, -1)
+	rows := make([]map[string]string, 0, len(matches))
+	for _, match := range matches {
+		row := make(map[string]string)
+		for i, name := range names {
+			if name != "" {
+				row[name] = match[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// buildOutput validates the output format and compiles the extract pattern of a command
+func (cd *commandDocument) buildOutput(command *Command) error {
+	switch cd.Output {
+	case "", OutputText:
+	case OutputJSON:
+		if cd.Extract != "" {
+			return fmt.Errorf("extract can't be combined with %s output", OutputJSON)
+		}
+	default:
+		return fmt.Errorf("unknown output format %q", cd.Output)
+	}
+	command.Output = cd.Output
+
+	if cd.Extract == "" {
+		return nil
+	}
+
+	pattern, err := regexp.Compile(cd.Extract)
+	if err != nil {
+		return fmt.Errorf("invalid extract pattern: %w", err)
+	}
+
+	named := false
+	for _, name := range pattern.SubexpNames() {
+		named = named || name != ""
+	}
+	if !named {
+		return fmt.Errorf("extract pattern %q has no named groups, e.g. (?P<version>\\S+)", cd.Extract)
+	}
+
+	command.Extract = cd.Extract
+	command.extract = pattern
+	return nil
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/ini.v1"
+)
+
+// Parameter types
+const (
+	ParamInt    = "int"
+	ParamString = "string"
+	ParamEnum   = "enum"
+	ParamPath   = "path"
+)
+
+// paramSectionPrefix starts the name of the INI sections declaring parameters,
+// e.g. [params.openlog.lines] declares the "lines" parameter of openlogCommand
+const paramSectionPrefix = "params."
+
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedParamNames clash with the form fields used to select a command
+var reservedParamNames = []string{"value", "custom_command"}
+
+// Param describes a typed parameter accepted by a command
+type Param struct {
+	Name        string
+	Type        string
+	Pattern     string
+	Default     string
+	Options     []string
+	Required    bool
+	Description string
+
+	pattern *regexp.Regexp
+}
+
+// Validate checks value against the parameter type and pattern
+func (p *Param) Validate(value string) error {
+	switch p.Type {
+	case ParamInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("parameter %s must be an integer", p.Name)
+		}
+	case ParamEnum:
+		if !slices.Contains(p.Options, value) {
+			return fmt.Errorf("parameter %s must be one of: %s", p.Name, strings.Join(p.Options, ", "))
+		}
+	case ParamPath:
+		if strings.ContainsRune(value, 0) || filepath.Clean(value) != value {
+			return fmt.Errorf("parameter %s must be a clean path", p.Name)
+		}
+	case ParamString:
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("parameter %s contains invalid characters", p.Name)
+		}
+	}
+
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return fmt.Errorf("parameter %s does not match %s", p.Name, p.Pattern)
+	}
+
+	return nil
+}
+
+// Render returns the command line for the given arguments. Arguments are validated
+// against the declared parameters and shell-quoted before being substituted into the
+// command template alongside the [paths] entries.
+func (c *Command) Render(paths map[string]string, args map[string]string) (string, error) {
+	if len(c.Params) == 0 {
+		return c.Command, nil
+	}
+
+	data := make(map[string]string, len(paths)+len(c.Params))
+	for name, path := range paths {
+		data[name] = path
+	}
+
+	for i := range c.Params {
+		p := &c.Params[i]
+		value := args[p.Name]
+		if value == "" {
+			value = p.Default
+		}
+		if value == "" {
+			if p.Required {
+				return "", fmt.Errorf("missing required parameter %s", p.Name)
+			}
+			data[p.Name] = ""
+			continue
+		}
+
+		if err := p.Validate(value); err != nil {
+			return "", err
+		}
+
+		if usesCmd(c.Shell) {
+			return "", fmt.Errorf("parameter %s can't be quoted safely for cmd.exe", p.Name)
+		}
+		if c.Shell == ShellNone {
+			// Without a shell the command is split on whitespace, so quoting can't help
+			if strings.ContainsFunc(value, isSpace) {
+				return "", fmt.Errorf("parameter %s must not contain whitespace", p.Name)
+			}
+			data[p.Name] = value
+		} else {
+			data[p.Name] = shellQuote(value)
+		}
+	}
+
+	tmpl, err := template.New(c.Value).Option("missingkey=error").Parse(c.Command)
+	if err != nil {
+		return "", fmt.Errorf("parsing command template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("rendering command template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// parseParams reads the [params.<base>.<name>] sections declared for a command
+func parseParams(cfg *ini.File, baseName string) []paramDocument {
+	prefix := paramSectionPrefix + baseName + "."
+
+	var params []paramDocument
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section.Name(), prefix) {
+			continue
+		}
+
+		params = append(params, paramDocument{
+			Name:        strings.TrimPrefix(section.Name(), prefix),
+			Type:        section.Key("type").String(),
+			Regex:       section.Key("regex").String(),
+			Default:     section.Key("default").String(),
+			Options:     section.Key("options").Strings(","),
+			Required:    section.Key("required").MustBool(false),
+			Description: section.Key("description").String(),
+		})
+	}
+
+	return params
+}
+
+// buildParams validates parameter declarations and compiles their patterns
+func buildParams(docs []paramDocument, paths map[string]string) ([]Param, error) {
+	var params []Param
+	for _, doc := range docs {
+		p := Param{
+			Name:        doc.Name,
+			Type:        doc.Type,
+			Pattern:     doc.Regex,
+			Default:     doc.Default,
+			Options:     doc.Options,
+			Required:    doc.Required,
+			Description: doc.Description,
+		}
+		if p.Type == "" {
+			p.Type = ParamString
+		}
+
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+		if _, ok := paths[p.Name]; ok {
+			return nil, fmt.Errorf("parameter %s shadows the [paths] entry of the same name", p.Name)
+		}
+
+		params = append(params, p)
+	}
+
+	return params, nil
+}
+
+// compile checks the declaration of a parameter and prepares its pattern
+func (p *Param) compile() error {
+	if !paramNamePattern.MatchString(p.Name) || slices.Contains(reservedParamNames, p.Name) {
+		return fmt.Errorf("invalid parameter name %q", p.Name)
+	}
+
+	switch p.Type {
+	case ParamInt, ParamString, ParamPath:
+	case ParamEnum:
+		if len(p.Options) == 0 {
+			return fmt.Errorf("enum parameter %s has no options", p.Name)
+		}
+	default:
+		return fmt.Errorf("parameter %s has unknown type %q", p.Name, p.Type)
+	}
+
+	if p.Pattern != "" {
+		pattern, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("parameter %s has invalid regex: %w", p.Name, err)
+		}
+		p.pattern = pattern
+	}
+
+	if p.Default != "" {
+		if err := p.Validate(p.Default); err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// usesCmd reports whether commands with the given shell run through cmd.exe,
+// which doesn't treat single quotes as quotes
+func usesCmd(shell string) bool {
+	return shell == "" && runtime.GOOS == "windows"
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Failure policies of a pipeline step
+const (
+	OnFailureAbort    = "abort"
+	OnFailureContinue = "continue"
+)
+
+// Step is one stage of a pipeline command. It runs the command with the given
+// Value. When Output is set, the step's output is passed to every later step
+// that declares a parameter of that name.
+type Step struct {
+	Value     string
+	OnFailure string
+	Output    string
+}
+
+// IsPipeline reports whether the command runs other commands as steps
+func (c *Command) IsPipeline() bool {
+	return len(c.Steps) > 0
+}
+
+// parseSteps splits a <base>Steps value such as
+// "format on_failure=continue, check output=status, restart" into steps
+func parseSteps(spec string) ([]stepDocument, error) {
+	var steps []stepDocument
+	for _, item := range strings.Split(spec, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+
+		step := stepDocument{Value: fields[0]}
+		for _, option := range fields[1:] {
+			key, value, ok := strings.Cut(option, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid option %q for step %s", option, step.Value)
+			}
+			switch key {
+			case "on_failure":
+				step.OnFailure = value
+			case "output":
+				step.Output = value
+			default:
+				return nil, fmt.Errorf("unknown option %q for step %s", key, step.Value)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// buildSteps validates the options of each step
+func buildSteps(docs []stepDocument) ([]Step, error) {
+	var steps []Step
+	for _, doc := range docs {
+		step := Step{Value: doc.Value, OnFailure: doc.OnFailure, Output: doc.Output}
+		if step.Value == "" {
+			return nil, fmt.Errorf("step without a command value")
+		}
+		switch step.OnFailure {
+		case "":
+			step.OnFailure = OnFailureAbort
+		case OnFailureAbort, OnFailureContinue:
+		default:
+			return nil, fmt.Errorf("step %s: on_failure must be %s or %s", step.Value, OnFailureAbort, OnFailureContinue)
+		}
+		if step.Output != "" && !paramNamePattern.MatchString(step.Output) {
+			return nil, fmt.Errorf("step %s: invalid output variable %q", step.Value, step.Output)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// validateSteps checks that every step refers to a plain command. Pipelines
+// can't be nested, which also rules out cycles. A pipeline may not be open to
+// roles that aren't allowed to run each of its steps.
+func validateSteps(commands []Command) error {
+	byValue := make(map[string]*Command, len(commands))
+	for i := range commands {
+		byValue[commands[i].Value] = &commands[i]
+	}
+
+	for _, command := range commands {
+		for _, step := range command.Steps {
+			target, ok := byValue[step.Value]
+			if !ok {
+				return fmt.Errorf("pipeline %s: step %s is not a defined command", command.Value, step.Value)
+			}
+			if target.IsPipeline() {
+				return fmt.Errorf("pipeline %s: step %s is itself a pipeline", command.Value, step.Value)
+			}
+			if !rolesWithin(command.Roles, target.Roles) {
+				return fmt.Errorf("pipeline %s: its roles must be limited to the roles of step %s (%s)", command.Value, step.Value, strings.Join(target.Roles, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// rolesWithin reports whether every role allowed by roles is allowed by limit.
+// An empty list allows everyone.
+func rolesWithin(roles, limit []string) bool {
+	if len(limit) == 0 {
+		return true
+	}
+	if len(roles) == 0 {
+		return false
+	}
+	for _, role := range roles {
+		if !slices.Contains(limit, role) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// documentLoader is implemented by every provider that reads a configuration file
+type documentLoader interface {
+	loadDocument() (*document, error)
+}
+
+// NewProvider returns the provider matching the extension of filePath:
+// .ini, .json, .yaml or .yml
+func NewProvider(filePath string, logger zerolog.Logger) (ConfigProvider, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".ini":
+		return NewFileConfigProvider(filePath, logger), nil
+	case ".json":
+		return NewJSONConfigProvider(filePath, logger), nil
+	case ".yaml", ".yml":
+		return NewYAMLConfigProvider(filePath, logger), nil
+	default:
+		return nil, fmt.Errorf("unsupported config file format: %s", filePath)
+	}
+}
+
+// JSONConfigProvider implements ConfigProvider for JSON files
+type JSONConfigProvider struct {
+	FilePath string
+	logger   zerolog.Logger
+}
+
+// NewJSONConfigProvider creates a new JSONConfigProvider
+func NewJSONConfigProvider(filePath string, logger zerolog.Logger) *JSONConfigProvider {
+	return &JSONConfigProvider{
+		FilePath: filePath,
+		logger:   logger,
+	}
+}
+
+// Load implements ConfigProvider.Load for JSON files
+func (jcp *JSONConfigProvider) Load(ctx context.Context) (*Config, error) {
+	doc, err := jcp.loadDocument()
+	if err != nil {
+		return nil, err
+	}
+	return doc.build()
+}
+
+func (jcp *JSONConfigProvider) loadDocument() (*document, error) {
+	data, err := os.ReadFile(jcp.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+
+	doc := defaultDocument()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return doc, nil
+}
+
+// YAMLConfigProvider implements ConfigProvider for YAML files
+type YAMLConfigProvider struct {
+	FilePath string
+	logger   zerolog.Logger
+}
+
+// NewYAMLConfigProvider creates a new YAMLConfigProvider
+func NewYAMLConfigProvider(filePath string, logger zerolog.Logger) *YAMLConfigProvider {
+	return &YAMLConfigProvider{
+		FilePath: filePath,
+		logger:   logger,
+	}
+}
+
+// Load implements ConfigProvider.Load for YAML files
+func (ycp *YAMLConfigProvider) Load(ctx context.Context) (*Config, error) {
+	doc, err := ycp.loadDocument()
+	if err != nil {
+		return nil, err
+	}
+	return doc.build()
+}
+
+func (ycp *YAMLConfigProvider) loadDocument() (*document, error) {
+	data, err := os.ReadFile(ycp.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+
+	doc := defaultDocument()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return doc, nil
+}
+
+// Migrate converts the configuration file at src into the format given by the
+// extension of dst (.json, .yaml or .yml). It refuses to overwrite dst.
+func Migrate(src, dst string, logger zerolog.Logger) error {
+	provider, err := NewProvider(src, logger)
+	if err != nil {
+		return err
+	}
+
+	loader, ok := provider.(documentLoader)
+	if !ok {
+		return fmt.Errorf("can't migrate from %s", src)
+	}
+
+	doc, err := loader.loadDocument()
+	if err != nil {
+		return err
+	}
+
+	// Make sure the result loads before writing it out
+	if _, err := doc.build(); err != nil {
+		return fmt.Errorf("source config is invalid: %w", err)
+	}
+
+	var data []byte
+	switch strings.ToLower(filepath.Ext(dst)) {
+	case ".json":
+		data, err = json.MarshalIndent(doc, "", "  ")
+		data = append(data, '\n')
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(doc)
+	default:
+		return fmt.Errorf("unsupported target format: %s", dst)
+	}
+	if err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+
+	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists", dst)
+		}
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// leadingPlaceholder matches a command starting with a placeholder, e.g. "{{.corePath}} start"
+var leadingPlaceholder = regexp.MustCompile(`^\{\{\s*\.(\w+)\s*\}\}`)
+
+// Validate checks a parsed configuration for mistakes the parser lets through.
+// Errors make the configuration unusable, warnings are only reported. A [paths]
+// binary that can't be found is an error, unless the active configuration,
+// which may be nil, already points at the same missing file: rejecting it
+// then would keep out every other change, or stop the service from starting.
+func Validate(cfg *Config, active *Config) (errs []error, warnings []string) {
+	seen := make(map[string]bool, len(cfg.Commands))
+	for _, command := range cfg.Commands {
+		if command.Value == "custom" {
+			errs = append(errs, fmt.Errorf("command %s: value 'custom' is reserved", command.Name))
+		}
+		if seen[command.Value] {
+			errs = append(errs, fmt.Errorf("command %s: duplicate value %q", command.Name, command.Value))
+		}
+		seen[command.Value] = true
+
+		if command.IsPipeline() {
+			continue
+		}
+
+		if err := checkPlaceholders(&command, cfg.Paths); err != nil {
+			errs = append(errs, fmt.Errorf("command %s: %w", command.Value, err))
+		}
+
+		if name, path, ok := referencedBinary(&command, cfg.Paths); ok {
+			if _, err := exec.LookPath(path); err != nil {
+				msg := fmt.Sprintf("command %s: binary %s from [paths] is not available", command.Value, path)
+				if active == nil || active.Paths[name] == path {
+					warnings = append(warnings, msg)
+				} else {
+					errs = append(errs, errors.New(msg))
+				}
+			}
+		}
+	}
+
+	return errs, warnings
+}
+
+// checkPlaceholders renders the raw command template with every [paths] entry and
+// declared parameter defined, so any other placeholder is reported as undefined
+func checkPlaceholders(command *Command, paths map[string]string) error {
+	data := make(map[string]string, len(paths)+len(command.Params))
+	for name, path := range paths {
+		data[name] = path
+	}
+	for _, p := range command.Params {
+		data[p.Name] = p.Name
+	}
+
+	tmpl, err := template.New(command.Value).Option("missingkey=error").Parse(command.rawCommand)
+	if err != nil {
+		return fmt.Errorf("invalid command template: %w", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, data); err != nil {
+		return fmt.Errorf("undefined placeholder: %w", err)
+	}
+	return nil
+}
+
+// referencedBinary returns the name and path of the [paths] entry a command
+// starts with, if any
+func referencedBinary(command *Command, paths map[string]string) (string, string, bool) {
+	match := leadingPlaceholder.FindStringSubmatch(strings.TrimSpace(command.rawCommand))
+	if match == nil {
+		return "", "", false
+	}
+	path, ok := paths[match[1]]
+	return match[1], path, ok
+}
+
+// diffCommands compares two command lists by value
+func diffCommands(old, updated []Command) (added, removed, changed []string) {
+	previous := make(map[string]Command, len(old))
+	for _, command := range old {
+		previous[command.Value] = command
+	}
+
+	for _, command := range updated {
+		before, ok := previous[command.Value]
+		if !ok {
+			added = append(added, command.Value)
+			continue
+		}
+		if !sameCommand(before, command) {
+			changed = append(changed, command.Value)
+		}
+		delete(previous, command.Value)
+	}
+
+	for value := range previous {
+		removed = append(removed, value)
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+
+	return added, removed, changed
+}
+
+// sameCommand compares two commands, ignoring the compiled parameter patterns
+func sameCommand(a, b Command) bool {
+	a.Params = withoutCompiledPatterns(a.Params)
+	b.Params = withoutCompiledPatterns(b.Params)
+	a.extract, b.extract = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+func withoutCompiledPatterns(params []Param) []Param {
+	if params == nil {
+		return nil
+	}
+	stripped := slices.Clone(params)
+	for i := range stripped {
+		stripped[i].pattern = nil
+	}
+	return stripped
+}
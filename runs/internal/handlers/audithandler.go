@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"runs/internal/audit"
+	"runs/internal/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultAuditLimit = 100
+
+// GetAuditLog returns audit entries filtered by the command, from, to, outcome
+// and limit query parameters, newest first
+func (h *Handler) GetAuditLog(c *fiber.Ctx) error {
+	if h.auditStore == nil {
+		return handleError(c, fiber.StatusNotFound, "Audit log is disabled")
+	}
+
+	if !h.authorizedExplicitly(c, h.configManager.GetConfig().Auth.AuditRoles) {
+		return handleError(c, fiber.StatusForbidden, "Not allowed to read the audit log")
+	}
+
+	filter := audit.Filter{
+		Value:   c.Query("command"),
+		Outcome: c.Query("outcome"),
+		Limit:   c.QueryInt("limit", defaultAuditLimit),
+	}
+
+	switch filter.Outcome {
+	case "", audit.OutcomeSuccess, audit.OutcomeFailure:
+	default:
+		return handleError(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid outcome '%s'", filter.Outcome))
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return handleError(c, fiber.StatusBadRequest, err.Error())
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return handleError(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	entries, err := h.auditStore.Query(filter)
+	if err != nil {
+		return handleError(c, fiber.StatusInternalServerError, "Failed to read audit log: "+err.Error())
+	}
+
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Data: entries})
+}
+
+// parseTimeQuery parses an optional RFC 3339 timestamp from the query string
+func parseTimeQuery(c *fiber.Ctx, key string) (time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid '%s' time, expected RFC 3339: %s", key, value)
+	}
+	return t, nil
+}
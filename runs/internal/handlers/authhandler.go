@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"runs/internal/auth"
+	"runs/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Login checks the submitted credentials and starts a session. The token is
+// returned in the body for API clients and set as a cookie for the browser.
+func (h *Handler) Login(c *fiber.Ctx) error {
+	if !h.authManager.Enabled() {
+		return handleError(c, fiber.StatusNotFound, "Authentication is disabled")
+	}
+
+	session, err := h.authManager.Login(c.FormValue("username"), c.FormValue("password"))
+	if err != nil {
+		return handleError(c, fiber.StatusUnauthorized, err.Error())
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     auth.CookieName,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		// Strict keeps the cookie off requests started from other sites,
+		// including links to GET endpoints
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Message: "Logged in", Data: session})
+}
+
+// Logout ends the current session
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	h.authManager.Logout(auth.Token(c))
+	c.ClearCookie(auth.CookieName)
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Message: "Logged out"})
+}
+
+// CurrentUser returns the session of the requesting user
+func (h *Handler) CurrentUser(c *fiber.Ctx) error {
+	session, ok := auth.SessionFromCtx(c)
+	if !ok {
+		return handleError(c, fiber.StatusNotFound, "Authentication is disabled")
+	}
+
+	current := *session
+	current.Token = ""
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Data: current})
+}
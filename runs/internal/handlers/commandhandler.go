@@ -1,12 +1,18 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"runs/internal/audit"
+	"runs/internal/auth"
 	"runs/internal/config"
+	"runs/internal/jobs"
+	"runs/internal/limiter"
 	"runs/internal/logger"
 	"runs/internal/models"
-	"runs/internal/utils"
+	"runs/internal/runner"
+	"runs/internal/scheduler"
+	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -18,58 +24,159 @@ const defaultTimeout = 10 * time.Second
 // Handler struct holds dependencies for the handlers
 type Handler struct {
 	configManager *config.ConfigManager
+	jobManager    *jobs.Manager
+	authManager   *auth.Manager
+	runner        *runner.Runner
+	auditStore    *audit.Store
+	scheduler     *scheduler.Scheduler
+	limiter       *limiter.Limiter
 }
 
-// NewHandler creates a new Handler instance
-func NewHandler(cm *config.ConfigManager) *Handler {
+// NewHandler creates a new Handler instance. A nil audit store disables the audit endpoint.
+func NewHandler(cm *config.ConfigManager, jm *jobs.Manager, am *auth.Manager, r *runner.Runner, as *audit.Store, s *scheduler.Scheduler, l *limiter.Limiter) *Handler {
 	return &Handler{
 		configManager: cm,
+		jobManager:    jm,
+		authManager:   am,
+		runner:        r,
+		auditStore:    as,
+		scheduler:     s,
+		limiter:       l,
 	}
 }
 
 // CommandHandler handles the command execution
 func (h *Handler) CommandHandler(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(c.Context(), defaultTimeout)
-	defer cancel()
-
 	value := c.FormValue("value")
 	if value == "" {
 		return handleError(c, fiber.StatusBadRequest, "Missing 'value' parameter")
 	}
 
-	command, err := h.processCommand(c, value)
-	if err != nil {
-		return handleError(c, fiber.StatusBadRequest, err.Error())
+	command, ferr := h.processCommand(c, value)
+	if ferr != nil {
+		return handleError(c, ferr.Code, ferr.Message)
 	}
 
-	output, err := utils.RunCommand(ctx, command.Command, defaultTimeout)
+	req := h.newRequest(c, value, command, runner.SourceAPI, defaultTimeout)
+	if command.IsPipeline() {
+		return h.runPipeline(c, req)
+	}
+
+	output, err := h.runner.Run(c.Context(), req)
 	if err != nil {
 		logger.GetLogger().Error().Str("command", command.Command).Err(err).Msg("Failed to execute command")
-		return handleError(c, fiber.StatusInternalServerError, fmt.Sprintf("Failed to execute command '%s': %v", command.Command, err))
+		return handleError(c, executionStatus(err), fmt.Sprintf("Failed to execute command '%s': %v", command.Command, err))
+	}
+
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Message: output, Data: runner.ParseOutput(command, output)})
+}
+
+// runPipeline runs the steps of a pipeline and responds with the result of each step
+func (h *Handler) runPipeline(c *fiber.Ctx, req runner.Request) error {
+	steps, err := h.runner.RunPipeline(c.Context(), req)
+	if err != nil {
+		logger.GetLogger().Error().Str("pipeline", req.Value).Err(err).Msg("Pipeline failed")
+		return respondWithJSON(c, executionStatus(err), models.Response{Message: err.Error(), Data: steps})
 	}
 
-	return respondWithJSON(c, fiber.StatusOK, models.Response{Message: output})
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Message: runner.FormatSteps(steps), Data: steps})
 }
 
-// processCommand processes the command based on the given value
-func (h *Handler) processCommand(c *fiber.Ctx, value string) (*config.Command, error) {
+// executionStatus maps an execution error to a response status. A command that
+// could not start because of a lock or the concurrency limit is a conflict.
+func executionStatus(err error) int {
+	if errors.Is(err, limiter.ErrLocked) || errors.Is(err, limiter.ErrTooBusy) {
+		return fiber.StatusConflict
+	}
+	if errors.Is(err, runner.ErrShuttingDown) {
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusInternalServerError
+}
+
+// processCommand resolves the command for the given value and renders its parameters
+// from the request. The returned error carries the HTTP status to respond with.
+func (h *Handler) processCommand(c *fiber.Ctx, value string) (*config.Command, *fiber.Error) {
+	cfg := h.configManager.GetConfig()
+
 	if value == "custom" {
+		if !cfg.WebConf.AllowCustom {
+			return nil, fiber.NewError(fiber.StatusForbidden, "Custom commands are disabled")
+		}
+		if !h.authorizedExplicitly(c, cfg.Auth.CustomRoles) {
+			return nil, fiber.NewError(fiber.StatusForbidden, "Not allowed to run custom commands")
+		}
 		customCommand := c.FormValue("custom_command")
 		if customCommand == "" {
-			return nil, fmt.Errorf("missing 'custom_command' parameter")
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Missing 'custom_command' parameter")
 		}
-		return &config.Command{Command: customCommand}, nil
+		return &config.Command{Command: customCommand, Roles: cfg.Auth.CustomRoles}, nil
 	}
 
 	command, err := h.configManager.FindCommandByValue(value)
 	if err != nil {
-		return nil, fmt.Errorf("command with Value '%s' not found", value)
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Command with Value '%s' not found", value))
+	}
+
+	if !h.authorized(c, command.Roles) {
+		return nil, fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("Not allowed to run '%s'", value))
 	}
 
-	// The command is already processed by the config package, so we don't need to replace placeholders here
+	if len(command.Params) == 0 {
+		// The command is already processed by the config package, so we don't need to replace placeholders here
+		return command, nil
+	}
+
+	args := make(map[string]string, len(command.Params))
+	for _, p := range command.Params {
+		args[p.Name] = c.FormValue(p.Name)
+	}
+
+	rendered, err := command.Render(cfg.Paths, args)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	command.Command = rendered
+
 	return command, nil
 }
 
+// newRequest describes an execution of command on behalf of the requesting client
+func (h *Handler) newRequest(c *fiber.Ctx, value string, command *config.Command, source string, timeout time.Duration) runner.Request {
+	// fiber's strings are only valid during the request, jobs and metrics keep them around
+	req := runner.Request{
+		Value:    strings.Clone(value),
+		Command:  command,
+		Source:   source,
+		ClientIP: strings.Clone(c.IP()),
+		Timeout:  timeout,
+	}
+	if session, ok := auth.SessionFromCtx(c); ok {
+		req.User = session.User
+	}
+	return req
+}
+
+// authorized reports whether the requesting user holds one of roles. Everything
+// is allowed while authentication is disabled.
+func (h *Handler) authorized(c *fiber.Ctx, roles []string) bool {
+	if !h.authManager.Enabled() {
+		return true
+	}
+	session, ok := auth.SessionFromCtx(c)
+	return ok && session.HasAnyRole(roles)
+}
+
+// authorizedExplicitly is like authorized, except that an empty roles list
+// denies everyone. Custom commands and the audit log must be opened up on purpose.
+func (h *Handler) authorizedExplicitly(c *fiber.Ctx, roles []string) bool {
+	if !h.authManager.Enabled() {
+		return true
+	}
+	session, ok := auth.SessionFromCtx(c)
+	return ok && session.HasRequiredRole(roles)
+}
+
 // handleError logs and responds with an error message
 func handleError(c *fiber.Ctx, status int, message string) error {
 	logger.GetLogger().Error().Int("status", status).Msg(message)
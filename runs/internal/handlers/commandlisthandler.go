@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"runs/internal/config"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -11,9 +13,16 @@ func (h *Handler) GetCommandList(c *fiber.Ctx) error {
 		return respondWithError(c, fiber.StatusInternalServerError, "Configuration not loaded")
 	}
 
-	if len(cfg.Commands) == 0 {
+	commands := make([]config.Command, 0, len(cfg.Commands))
+	for _, command := range cfg.Commands {
+		if h.authorized(c, command.Roles) {
+			commands = append(commands, command)
+		}
+	}
+
+	if len(commands) == 0 {
 		return respondWithError(c, fiber.StatusNotFound, "No commands available")
 	}
 
-	return respondWithJSON(c, fiber.StatusOK, cfg.Commands)
+	return respondWithJSON(c, fiber.StatusOK, commands)
 }
\ No newline at end of file
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"runs/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetConfigStatus reports when the configuration was last loaded, why the last
+// reload was rejected if it was, and which commands the last reload changed
+func (h *Handler) GetConfigStatus(c *fiber.Ctx) error {
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Data: h.configManager.Status()})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"runs/internal/jobs"
+	"runs/internal/models"
+	"runs/internal/runner"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StartJob starts a command in the background and returns the new job
+func (h *Handler) StartJob(c *fiber.Ctx) error {
+	value := c.FormValue("value")
+	if value == "" {
+		return handleError(c, fiber.StatusBadRequest, "Missing 'value' parameter")
+	}
+
+	command, ferr := h.processCommand(c, value)
+	if ferr != nil {
+		return handleError(c, ferr.Code, ferr.Message)
+	}
+
+	job, err := h.jobManager.Start(h.newRequest(c, value, command, runner.SourceJob, 0))
+	if err != nil {
+		return handleError(c, fiber.StatusInternalServerError, "Failed to start job: "+err.Error())
+	}
+
+	return respondWithJSON(c, fiber.StatusAccepted, models.Response{Data: job})
+}
+
+// ListJobs returns the running and recently finished jobs of commands the user may run
+func (h *Handler) ListJobs(c *fiber.Ctx) error {
+	all := h.jobManager.List()
+	visible := make([]jobs.Job, 0, len(all))
+	for _, job := range all {
+		if h.authorized(c, job.Roles) {
+			visible = append(visible, job)
+		}
+	}
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Data: visible})
+}
+
+// GetJob returns the state and captured output of a job
+func (h *Handler) GetJob(c *fiber.Ctx) error {
+	job, ferr := h.findJob(c, c.Params("id"))
+	if ferr != nil {
+		return handleError(c, ferr.Code, ferr.Message)
+	}
+
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Data: job})
+}
+
+// CancelJob cancels a running job
+func (h *Handler) CancelJob(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if _, ferr := h.findJob(c, id); ferr != nil {
+		return handleError(c, ferr.Code, ferr.Message)
+	}
+	if err := h.jobManager.Cancel(id); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return handleError(c, fiber.StatusNotFound, err.Error())
+		}
+		return handleError(c, fiber.StatusConflict, err.Error())
+	}
+
+	job, err := h.jobManager.Get(id)
+	if err != nil {
+		return handleError(c, fiber.StatusNotFound, err.Error())
+	}
+
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Message: "Job cancelled", Data: job})
+}
+
+// findJob returns the job with the given ID if the user may run its command.
+// The returned error carries the HTTP status to respond with.
+func (h *Handler) findJob(c *fiber.Ctx, id string) (jobs.Job, *fiber.Error) {
+	job, err := h.jobManager.Get(id)
+	if err != nil {
+		return jobs.Job{}, fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if !h.authorized(c, job.Roles) {
+		return jobs.Job{}, fiber.NewError(fiber.StatusForbidden, "Not allowed to access this job")
+	}
+	return job, nil
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"runs/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetLocks returns the running and queued commands with their lock groups
+func (h *Handler) GetLocks(c *fiber.Ctx) error {
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Data: h.limiter.State()})
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"runs/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSchedules returns every scheduled command with its next and last run
+func (h *Handler) GetSchedules(c *fiber.Ctx) error {
+	return respondWithJSON(c, fiber.StatusOK, models.Response{Data: h.scheduler.Status()})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"runs/internal/auth"
+	"runs/internal/logger"
+	"runs/internal/models"
+	"runs/internal/runner"
+	"runs/internal/utils"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gofiber/fiber/v2"
+)
+
+const streamTimeout = 10 * time.Minute
+
+// StreamCommandHandler executes a command and streams its output as server-sent events.
+// Every line is sent as an "output" event tagged with its stream, followed by a single
+// "exit" event carrying the exit code and duration.
+func (h *Handler) StreamCommandHandler(c *fiber.Ctx) error {
+	// Streaming is a GET that runs a command, which a cross-site link could
+	// trigger with the session cookie, so it needs the token as a header
+	if h.authManager.Enabled() && auth.BearerToken(c) == "" {
+		return handleError(c, fiber.StatusUnauthorized, "Streaming needs the session token in an Authorization: Bearer header")
+	}
+
+	value := c.Query("value")
+	if value == "" {
+		return handleError(c, fiber.StatusBadRequest, "Missing 'value' parameter")
+	}
+
+	command, ferr := h.processCommand(c, value)
+	if ferr != nil {
+		return handleError(c, ferr.Code, ferr.Message)
+	}
+
+	if command.IsPipeline() {
+		return handleError(c, fiber.StatusBadRequest, "Pipelines can't be streamed, run them through /api/command/execute or /api/jobs")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	req := h.newRequest(c, value, command, runner.SourceStream, streamTimeout)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The request context is not cancelled when the client goes away, so a
+		// failed write is what stops the command.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var writeErr error
+		result, err := h.runner.Stream(ctx, req, func(line utils.OutputLine) {
+			if writeErr != nil {
+				return
+			}
+			if writeErr = writeEvent(w, "output", line); writeErr != nil {
+				cancel()
+			}
+		})
+		if writeErr != nil {
+			logger.GetLogger().Warn().Str("command", command.Command).Err(writeErr).Msg("Stream client disconnected")
+			return
+		}
+
+		exit := models.CommandExit{ExitCode: -1}
+		if result != nil {
+			exit.ExitCode = result.ExitCode
+			exit.DurationMs = result.Duration.Milliseconds()
+		}
+		if err != nil {
+			logger.GetLogger().Error().Str("command", command.Command).Err(err).Msg("Failed to execute command")
+			exit.Error = err.Error()
+		}
+		if err := writeEvent(w, "exit", exit); err != nil {
+			logger.GetLogger().Warn().Err(err).Msg("Error writing exit event")
+		}
+	})
+
+	return nil
+}
+
+// writeEvent writes a single server-sent event and flushes it to the client
+func writeEvent(w *bufio.Writer, event string, payload any) error {
+	data, err := sonic.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", event, err)
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
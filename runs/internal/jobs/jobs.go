@@ -0,0 +1,239 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"runs/internal/logger"
+	"runs/internal/runner"
+	"runs/internal/utils"
+)
+
+var (
+	// ErrNotFound is returned when no job exists with the given ID
+	ErrNotFound = errors.New("job not found")
+	// ErrNotRunning is returned when cancelling a job that already finished
+	ErrNotRunning = errors.New("job is not running")
+)
+
+// State describes the lifecycle stage of a job
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// Job is a snapshot of a command running in the background
+type Job struct {
+	ID        string              `json:"id"`
+	Value     string              `json:"value"`
+	Command   string              `json:"command"`
+	User      string              `json:"user,omitempty"`
+	State     State               `json:"state"`
+	ExitCode  *int                `json:"exitCode,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Output    string              `json:"output,omitempty"`
+	Data      any                 `json:"data,omitempty"`
+	Steps     []runner.StepResult `json:"steps,omitempty"`
+	StartedAt time.Time           `json:"startedAt"`
+	EndedAt   *time.Time          `json:"endedAt,omitempty"`
+
+	// Roles may see and cancel the job, the same roles that may run its command
+	Roles []string `json:"-"`
+}
+
+type job struct {
+	Job
+	req    runner.Request
+	output strings.Builder
+	cancel context.CancelFunc
+}
+
+// Manager runs commands in the background and keeps a bounded history of finished jobs
+type Manager struct {
+	runner      *runner.Runner
+	mu          sync.RWMutex
+	jobs        map[string]*job
+	finished    []string // IDs of finished jobs, oldest first
+	historySize int
+	timeout     time.Duration
+}
+
+// NewManager creates a new Manager that keeps at most historySize finished jobs.
+// timeout applies to commands that do not configure their own.
+func NewManager(r *runner.Runner, historySize int, timeout time.Duration) *Manager {
+	return &Manager{
+		runner:      r,
+		jobs:        make(map[string]*job),
+		historySize: historySize,
+		timeout:     timeout,
+	}
+}
+
+// Start launches the request in the background and returns a snapshot of the new job
+func (m *Manager) Start(req runner.Request) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	req.Source = runner.SourceJob
+	if req.Timeout <= 0 {
+		req.Timeout = m.timeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		Job: Job{
+			ID:        id,
+			Value:     req.Value,
+			Command:   req.Command.Command,
+			User:      req.User,
+			Roles:     req.Command.Roles,
+			State:     StateRunning,
+			StartedAt: time.Now(),
+		},
+		req:    req,
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = j
+	snapshot := j.snapshot()
+	m.mu.Unlock()
+
+	go m.run(ctx, j)
+
+	return snapshot, nil
+}
+
+// Get returns a snapshot of the job with the given ID
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// List returns snapshots of all known jobs, newest first. Output and data are omitted.
+func (m *Manager) List() []Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		entry := j.Job
+		entry.Data = nil
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].StartedAt.After(list[b].StartedAt)
+	})
+	return list
+}
+
+// Cancel stops a running job through its context
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if j.State != StateRunning {
+		return ErrNotRunning
+	}
+
+	j.State = StateCanceled
+	j.cancel()
+	return nil
+}
+
+func (m *Manager) run(ctx context.Context, j *job) {
+	defer j.cancel()
+
+	exitCode, err := m.execute(ctx, j)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	j.EndedAt = &now
+	j.ExitCode = exitCode
+
+	switch {
+	case j.State == StateCanceled:
+		// Cancel already set the final state
+	case err != nil:
+		j.State = StateFailed
+		j.Error = err.Error()
+	case exitCode == nil || *exitCode != 0:
+		j.State = StateFailed
+	default:
+		j.State = StateSucceeded
+		if !j.req.Command.IsPipeline() {
+			j.Data = runner.ParseOutput(j.req.Command, strings.TrimSpace(j.output.String()))
+		}
+	}
+
+	logger.GetLogger().Info().Str("job", j.ID).Str("value", j.Value).Str("state", string(j.State)).Msg("Job finished")
+
+	m.finished = append(m.finished, j.ID)
+	for len(m.finished) > m.historySize {
+		delete(m.jobs, m.finished[0])
+		m.finished = m.finished[1:]
+	}
+}
+
+// execute runs the command of a job, or its steps if it is a pipeline, and returns the exit code if known
+func (m *Manager) execute(ctx context.Context, j *job) (*int, error) {
+	if j.req.Command.IsPipeline() {
+		steps, err := m.runner.RunPipeline(ctx, j.req)
+		m.mu.Lock()
+		j.Steps = steps
+		j.output.WriteString(runner.FormatSteps(steps))
+		m.mu.Unlock()
+
+		exitCode := utils.ExitCode(err)
+		return &exitCode, err
+	}
+
+	result, err := m.runner.Stream(ctx, j.req, func(line utils.OutputLine) {
+		m.mu.Lock()
+		j.output.WriteString(line.Text)
+		j.output.WriteByte('\n')
+		m.mu.Unlock()
+	})
+	if result == nil {
+		return nil, err
+	}
+	return &result.ExitCode, err
+}
+
+func (j *job) snapshot() Job {
+	snapshot := j.Job
+	snapshot.Output = strings.TrimSpace(j.output.String())
+	return snapshot
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
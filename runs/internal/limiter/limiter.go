@@ -0,0 +1,193 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"runs/internal/config"
+)
+
+var (
+	// ErrLocked is returned in reject mode when another command holds the lock group
+	ErrLocked = errors.New("lock group is busy")
+	// ErrTooBusy is returned in reject mode when the global concurrency limit is reached
+	ErrTooBusy = errors.New("too many commands running")
+	// ErrQueueTimeout is returned when a queued command waited longer than the queue timeout
+	ErrQueueTimeout = errors.New("timed out waiting for a free slot")
+)
+
+// Slot describes a running or queued command
+type Slot struct {
+	Value string    `json:"value"`
+	Lock  string    `json:"lock,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// State is a snapshot of the limiter
+type State struct {
+	MaxConcurrent int    `json:"maxConcurrent"`
+	Mode          string `json:"mode"`
+	Running       []Slot `json:"running"`
+	Waiting       []Slot `json:"waiting"`
+}
+
+// Limiter bounds the number of commands running at once and serialises commands
+// that share a lock group. Queued commands start in the order they arrived, a
+// command only overtakes earlier ones that wait for a different lock group.
+// Limits are read from the current configuration on every acquisition, so
+// reloads take effect for the next command.
+type Limiter struct {
+	configManager *config.ConfigManager
+
+	mu      sync.Mutex
+	running []*Slot
+	waiting []*waiter // in arrival order
+}
+
+// waiter is a queued command, ready is closed once it has been given a slot
+type waiter struct {
+	slot  *Slot
+	ready chan struct{}
+}
+
+// New creates a new Limiter
+func New(cm *config.ConfigManager) *Limiter {
+	return &Limiter{configManager: cm}
+}
+
+// Acquire takes a slot for the command with the given value and lock group. In
+// queue mode it waits for a free slot, in reject mode it fails immediately.
+// The returned function releases the slot.
+func (l *Limiter) Acquire(ctx context.Context, value, lock string) (func(), error) {
+	limits := l.configManager.GetConfig().Limits
+	if limits.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.QueueTimeout)
+		defer cancel()
+	}
+
+	slot := &Slot{Value: value, Lock: lock, Since: time.Now()}
+
+	l.mu.Lock()
+	// A raised limit lets queued commands in before this one
+	l.dispatch()
+	err := l.blocked(lock, limits.MaxConcurrent)
+	if err == nil {
+		l.running = append(l.running, slot)
+		l.mu.Unlock()
+		return func() { l.release(slot) }, nil
+	}
+	if limits.LockMode == config.LockModeReject {
+		l.mu.Unlock()
+		return nil, err
+	}
+
+	w := &waiter{slot: slot, ready: make(chan struct{})}
+	l.waiting = append(l.waiting, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return func() { l.release(slot) }, nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-w.ready:
+		// The slot was handed over while the context ended, give it back
+		l.removeRunning(slot)
+	default:
+		l.waiting = slices.DeleteFunc(l.waiting, func(q *waiter) bool { return q == w })
+	}
+	l.dispatch()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: %w", ErrQueueTimeout, err)
+	}
+	return nil, ctx.Err()
+}
+
+// State returns the running and queued commands
+func (l *Limiter) State() State {
+	limits := l.configManager.GetConfig().Limits
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := State{
+		MaxConcurrent: limits.MaxConcurrent,
+		Mode:          limits.LockMode,
+		Running:       make([]Slot, 0, len(l.running)),
+		Waiting:       make([]Slot, 0, len(l.waiting)),
+	}
+	for _, slot := range l.running {
+		state.Running = append(state.Running, *slot)
+	}
+	for _, w := range l.waiting {
+		state.Waiting = append(state.Waiting, *w.slot)
+	}
+	return state
+}
+
+// blocked reports why a command in the given lock group can't start now. Queued
+// commands of the same lock group go first. Callers must hold l.mu.
+func (l *Limiter) blocked(lock string, maxConcurrent int) error {
+	if lock != "" {
+		for _, slot := range l.running {
+			if slot.Lock == lock {
+				return fmt.Errorf("%w: %s is held by %s", ErrLocked, lock, slot.Value)
+			}
+		}
+		for _, w := range l.waiting {
+			if w.slot.Lock == lock {
+				return fmt.Errorf("%w: %s is awaited by %s", ErrLocked, lock, w.slot.Value)
+			}
+		}
+	}
+	if maxConcurrent > 0 && len(l.running) >= maxConcurrent {
+		return fmt.Errorf("%w: limit is %d", ErrTooBusy, maxConcurrent)
+	}
+	return nil
+}
+
+func (l *Limiter) release(slot *Slot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.removeRunning(slot)
+	l.dispatch()
+}
+
+// dispatch starts queued commands in arrival order. A command whose lock group
+// is held waits without holding up later commands of other groups, while a full
+// concurrency limit holds up everyone. Callers must hold l.mu.
+func (l *Limiter) dispatch() {
+	maxConcurrent := l.configManager.GetConfig().Limits.MaxConcurrent
+
+	queued := l.waiting
+	l.waiting = nil
+	for i, w := range queued {
+		if maxConcurrent > 0 && len(l.running) >= maxConcurrent {
+			l.waiting = append(l.waiting, queued[i:]...)
+			return
+		}
+		if l.blocked(w.slot.Lock, 0) != nil {
+			l.waiting = append(l.waiting, w)
+			continue
+		}
+		w.slot.Since = time.Now()
+		l.running = append(l.running, w.slot)
+		close(w.ready)
+	}
+}
+
+// removeRunning drops slot from the running commands. Callers must hold l.mu.
+func (l *Limiter) removeRunning(slot *Slot) {
+	l.running = slices.DeleteFunc(l.running, func(s *Slot) bool { return s == slot })
+}
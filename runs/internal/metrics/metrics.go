@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "runs"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	commandExecutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_executions_total",
+		Help:      "Number of command executions.",
+	}, []string{"command"})
+
+	commandFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_failures_total",
+		Help:      "Number of failed command executions by exit code.",
+	}, []string{"command", "exit_code"})
+
+	commandTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_timeouts_total",
+		Help:      "Number of command executions that hit their timeout.",
+	}, []string{"command"})
+
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "Duration of command executions.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	}, []string{"command"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last config reload succeeded.",
+	})
+
+	configReloadTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful config reload.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		commandExecutions,
+		commandFailures,
+		commandTimeouts,
+		commandDuration,
+		httpRequests,
+		httpDuration,
+		configReloadSuccess,
+		configReloadTime,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
+
+// ObserveCommand records one command execution
+func ObserveCommand(value string, exitCode int, duration time.Duration, timedOut bool) {
+	commandExecutions.WithLabelValues(value).Inc()
+	commandDuration.WithLabelValues(value).Observe(duration.Seconds())
+	if exitCode != 0 {
+		commandFailures.WithLabelValues(value, strconv.Itoa(exitCode)).Inc()
+	}
+	if timedOut {
+		commandTimeouts.WithLabelValues(value).Inc()
+	}
+}
+
+// ObserveRequest records one HTTP request
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	// fiber reuses the method buffer once the request is done
+	method = strings.Clone(method)
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveConfigReload records the outcome of a config load
+func ObserveConfigReload(err error) {
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return
+	}
+	configReloadSuccess.Set(1)
+	configReloadTime.SetToCurrentTime()
+}
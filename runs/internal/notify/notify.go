@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"runs/internal/config"
+	"runs/internal/logger"
+)
+
+const (
+	queueSize   = 100
+	workers     = 2
+	baseBackoff = 2 * time.Second
+	maxBackoff  = time.Minute
+
+	// truncatedMarker starts output that was cut to the notifier's maxOutput
+	truncatedMarker = "[truncated]\n"
+)
+
+// Event describes a finished command execution
+type Event struct {
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host"`
+	Value      string    `json:"value"`
+	Name       string    `json:"name"`
+	Command    string    `json:"command"`
+	Source     string    `json:"source"`
+	User       string    `json:"user,omitempty"`
+	Outcome    string    `json:"outcome"`
+	ExitCode   int       `json:"exitCode"`
+	DurationMs int64     `json:"durationMs"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type delivery struct {
+	notifier config.Notifier
+	event    Event
+}
+
+// Dispatcher delivers notifications in the background so that sending them
+// never delays the response of the command that triggered them
+type Dispatcher struct {
+	configManager *config.ConfigManager
+	queue         chan delivery
+	stop          context.Context
+	stopAll       context.CancelFunc
+	wg            sync.WaitGroup
+	mu            sync.RWMutex
+	closed        bool
+}
+
+// New creates a Dispatcher and starts its workers
+func New(cm *config.ConfigManager) *Dispatcher {
+	stop, stopAll := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		configManager: cm,
+		queue:         make(chan delivery, queueSize),
+		stop:          stop,
+		stopAll:       stopAll,
+	}
+
+	d.wg.Add(workers)
+	for range workers {
+		go d.work()
+	}
+	return d
+}
+
+// Notify queues the event for every notifier of command that is interested in
+// the outcome. Events are dropped when the queue is full.
+func (d *Dispatcher) Notify(command *config.Command, event Event) {
+	if d == nil || !command.NotifiesOn(event.Outcome) {
+		return
+	}
+
+	if event.Host == "" {
+		event.Host, _ = os.Hostname()
+	}
+	event.Name = command.Name
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+
+	notifiers := d.configManager.GetConfig().Notifiers
+	for _, name := range command.Notify {
+		notifier, ok := notifiers[name]
+		if !ok {
+			continue
+		}
+
+		select {
+		case d.queue <- delivery{notifier: notifier, event: event}:
+		default:
+			logger.GetLogger().Warn().Str("notifier", name).Str("command", event.Value).Msg("Notification queue is full, dropping notification")
+		}
+	}
+}
+
+// Close stops accepting notifications and waits for the queued ones until ctx
+// is done. Pending retries are abandoned then.
+func (d *Dispatcher) Close(ctx context.Context) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.stopAll()
+		<-done
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for delivery := range d.queue {
+		d.deliver(delivery)
+	}
+}
+
+// deliver sends one notification, retrying failures that may be temporary
+// with exponential backoff
+func (d *Dispatcher) deliver(delivery delivery) {
+	n := delivery.notifier
+	backoff := baseBackoff
+	delivery.event.Output = truncateOutput(delivery.event.Output, n.MaxOutput)
+
+	for attempt := 0; ; attempt++ {
+		err := send(d.stop, n, delivery.event)
+		if err == nil {
+			return
+		}
+
+		if attempt >= n.Retries || !isRetryable(err) {
+			logger.GetLogger().Error().Err(err).Str("notifier", n.Name).Str("command", delivery.event.Value).Int("attempts", attempt+1).Msg("Failed to send notification")
+			return
+		}
+		logger.GetLogger().Warn().Err(err).Str("notifier", n.Name).Dur("retryIn", backoff).Msg("Failed to send notification, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-d.stop.Done():
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// truncateOutput keeps the last max bytes of output, where failures usually
+// show up. A max of 0 keeps all of it.
+func truncateOutput(output string, max int64) string {
+	if max <= 0 || int64(len(output)) <= max {
+		return output
+	}
+	start := len(output) - int(max)
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return truncatedMarker + output[start:]
+}
@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"runs/internal/config"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+// maxMessageOutput bounds how much command output goes into a default message
+const maxMessageOutput = 1000
+
+// retryableError marks a failure that may go away when the notification is
+// sent again, such as a network error or a 5xx response
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// isRetryable reports whether sending again may succeed
+func isRetryable(err error) bool {
+	var retryable *retryableError
+	return errors.As(err, &retryable)
+}
+
+// send delivers event to the notifier once
+func send(ctx context.Context, n config.Notifier, event Event) error {
+	ctx, cancel := context.WithTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	switch n.Type {
+	case config.NotifierWebhook:
+		return sendWebhook(ctx, n, event)
+	case config.NotifierTelegram:
+		return sendTelegram(ctx, n, event)
+	case config.NotifierScript:
+		return runScript(ctx, n, event)
+	default:
+		return fmt.Errorf("unknown notifier type %q", n.Type)
+	}
+}
+
+func sendWebhook(ctx context.Context, n config.Notifier, event Event) error {
+	body, err := render(n, event)
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		if body, err = json.Marshal(event); err != nil {
+			return fmt.Errorf("encoding event: %w", err)
+		}
+	}
+	if !json.Valid(body) {
+		return fmt.Errorf("body template did not produce valid JSON")
+	}
+
+	return post(ctx, n.URL, body)
+}
+
+func sendTelegram(ctx context.Context, n config.Notifier, event Event) error {
+	text, err := render(n, event)
+	if err != nil {
+		return err
+	}
+	if text == nil {
+		text = []byte(defaultMessage(event))
+	}
+
+	body, err := json.Marshal(map[string]string{"chat_id": n.ChatID, "text": string(text)})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	return post(ctx, fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, n.BotToken), body)
+}
+
+// runScript runs the notifier script with the event as JSON on stdin and its
+// main fields in RUNS_* environment variables
+func runScript(ctx context.Context, n config.Notifier, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, n.Script)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"RUNS_VALUE="+event.Value,
+		"RUNS_NAME="+event.Name,
+		"RUNS_OUTCOME="+event.Outcome,
+		"RUNS_EXIT_CODE="+strconv.Itoa(event.ExitCode),
+		"RUNS_DURATION_MS="+strconv.FormatInt(event.DurationMs, 10),
+		"RUNS_SOURCE="+event.Source,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		err = fmt.Errorf("script %s failed: %w: %s", n.Script, err, strings.TrimSpace(string(output)))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// The script ran, its own delivery may work next time
+			return &retryableError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+func post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL may carry a secret such as a bot token, keep it out of the logs
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return &retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+		// Other client errors mean the request itself is wrong, sending it again won't help
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return &retryableError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// render executes the notifier template, it returns nil when there is none
+func render(n config.Notifier, event Event) ([]byte, error) {
+	tmpl, err := n.Template()
+	if err != nil || tmpl == nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("rendering template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func defaultMessage(event Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s on %s: %s (exit code %d, %dms)", event.Name, event.Host, event.Outcome, event.ExitCode, event.DurationMs)
+	if event.Error != "" {
+		fmt.Fprintf(&b, "\n%s", event.Error)
+	}
+	if output := event.Output; output != "" {
+		if len(output) > maxMessageOutput {
+			output = output[len(output)-maxMessageOutput:]
+		}
+		fmt.Fprintf(&b, "\n\n%s", output)
+	}
+	return b.String()
+}
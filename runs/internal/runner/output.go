@@ -0,0 +1,22 @@
+package runner
+
+import (
+	"runs/internal/config"
+	"runs/internal/logger"
+)
+
+// ParseOutput returns the structured data declared for the output of command. It
+// returns nil when the command declares none or the output doesn't parse, the
+// raw output is still there for the caller to show.
+func ParseOutput(command *config.Command, output string) any {
+	if !command.HasStructuredOutput() {
+		return nil
+	}
+
+	data, err := command.ParseOutput(output)
+	if err != nil {
+		logger.GetLogger().Warn().Err(err).Str("command", command.Value).Msg("Failed to parse command output")
+		return nil
+	}
+	return data
+}
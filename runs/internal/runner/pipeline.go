@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"runs/internal/config"
+	"runs/internal/utils"
+)
+
+// StepResult is the outcome of one pipeline step
+type StepResult struct {
+	Value      string `json:"value"`
+	Command    string `json:"command,omitempty"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"`
+}
+
+// RunPipeline runs the steps of a pipeline command in order. A failing step stops
+// the pipeline unless it is marked on_failure=continue, in which case the remaining
+// steps still run. Every step is recorded as its own execution. A timeout set on
+// the pipeline applies to the steps that don't configure their own.
+func (r *Runner) RunPipeline(ctx context.Context, req Request) ([]StepResult, error) {
+	if req.Command.Timeout > 0 {
+		req.Timeout = req.Command.Timeout
+	}
+
+	start := time.Now()
+	cfg := r.configManager.GetConfig()
+	results := make([]StepResult, len(req.Command.Steps))
+	vars := make(map[string]string)
+
+	var pipelineErr error
+	for i, step := range req.Command.Steps {
+		results[i].Value = step.Value
+		if pipelineErr != nil {
+			results[i].Skipped = true
+			continue
+		}
+
+		output, err := r.runStep(ctx, req, cfg, step, vars, &results[i])
+		if step.Output != "" {
+			vars[step.Output] = output
+		}
+		if err != nil && step.OnFailure != config.OnFailureContinue {
+			pipelineErr = fmt.Errorf("pipeline %s stopped at step %s: %w", req.Value, step.Value, err)
+		}
+	}
+
+	exitCode := 0
+	if pipelineErr != nil {
+		exitCode = utils.ExitCode(pipelineErr)
+	}
+	r.notify(req, start, FormatSteps(results), exitCode, false, pipelineErr)
+
+	return results, pipelineErr
+}
+
+func (r *Runner) runStep(ctx context.Context, req Request, cfg *config.Config, step config.Step, vars map[string]string, result *StepResult) (string, error) {
+	start := time.Now()
+	defer func() {
+		result.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	command, err := r.configManager.FindCommandByValue(step.Value)
+	if err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		return "", err
+	}
+
+	rendered, err := command.Render(cfg.Paths, vars)
+	if err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		return "", err
+	}
+	command.Command = rendered
+	result.Command = rendered
+
+	output, err := r.Run(ctx, Request{
+		Value:    step.Value,
+		Command:  command,
+		Source:   req.Source,
+		User:     req.User,
+		ClientIP: req.ClientIP,
+		Timeout:  req.Timeout,
+	})
+	result.ExitCode = utils.ExitCode(err)
+	if cmdErr, ok := err.(*utils.CommandError); ok {
+		output = cmdErr.Output
+	}
+	result.Output = strings.TrimSpace(output)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result.Output, err
+}
+
+// FormatSteps renders step results as plain text, for places that only keep output
+func FormatSteps(results []StepResult) string {
+	var b strings.Builder
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			fmt.Fprintf(&b, "[%s] skipped\n", result.Value)
+		case result.Error != "":
+			fmt.Fprintf(&b, "[%s] failed: %s\n", result.Value, result.Error)
+		default:
+			fmt.Fprintf(&b, "[%s] exit code %d\n", result.Value, result.ExitCode)
+		}
+		if result.Output != "" && result.Error == "" {
+			b.WriteString(result.Output)
+			b.WriteByte('\n')
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
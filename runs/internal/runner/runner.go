@@ -0,0 +1,237 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"runs/internal/audit"
+	"runs/internal/config"
+	"runs/internal/limiter"
+	"runs/internal/logger"
+	"runs/internal/metrics"
+	"runs/internal/notify"
+	"runs/internal/utils"
+)
+
+// Sources of an execution, recorded in the audit log
+const (
+	SourceAPI      = "api"
+	SourceStream   = "stream"
+	SourceJob      = "job"
+	SourceSchedule = "schedule"
+	SourceCLI      = "cli"
+)
+
+// ErrShuttingDown is returned for executions requested after Shutdown was called
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Request describes a single command execution
+type Request struct {
+	Value    string
+	Command  *config.Command
+	Source   string
+	User     string
+	ClientIP string
+	// Timeout applies when the command does not configure its own
+	Timeout time.Duration
+}
+
+// Runner executes commands within the concurrency limits and records every
+// execution in the audit log
+type Runner struct {
+	configManager *config.ConfigManager
+	audit         *audit.Store
+	limiter       *limiter.Limiter
+	notifier      *notify.Dispatcher
+
+	// kill is cancelled when running commands outlive the shutdown grace period
+	kill     context.Context
+	killAll  context.CancelFunc
+	mu       sync.Mutex
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+// New creates a new Runner. A nil store disables auditing and a nil
+// dispatcher disables notifications.
+func New(cm *config.ConfigManager, store *audit.Store, l *limiter.Limiter, n *notify.Dispatcher) *Runner {
+	kill, killAll := context.WithCancel(context.Background())
+	return &Runner{
+		configManager: cm,
+		audit:         store,
+		limiter:       l,
+		notifier:      n,
+		kill:          kill,
+		killAll:       killAll,
+	}
+}
+
+// Shutdown stops accepting new executions and waits up to grace for the running
+// ones to finish. Commands still running after that are killed. It reports
+// whether every command finished on its own.
+func (r *Runner) Shutdown(grace time.Duration) bool {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(grace):
+		r.killAll()
+		<-done
+		return false
+	}
+}
+
+// begin registers an execution, the returned context is cancelled when the
+// request is or when Shutdown gives up waiting
+func (r *Runner) begin(ctx context.Context) (context.Context, func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, nil, ErrShuttingDown
+	}
+	r.inFlight.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(r.kill, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		r.inFlight.Done()
+	}, nil
+}
+
+// Run executes the command and returns its combined output
+func (r *Runner) Run(ctx context.Context, req Request) (string, error) {
+	ctx, end, err := r.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer end()
+
+	release, err := r.limiter.Acquire(ctx, req.Value, req.Command.Lock)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	start := time.Now()
+	output, err := utils.RunCommand(ctx, req.Command.Command, r.options(req))
+
+	recorded := output
+	if cmdErr, ok := err.(*utils.CommandError); ok {
+		recorded = cmdErr.Output
+	}
+	r.record(req, start, recorded, utils.ExitCode(err), err)
+
+	return output, err
+}
+
+// Stream executes the command and calls onLine for every line of output as it is produced
+func (r *Runner) Stream(ctx context.Context, req Request, onLine func(utils.OutputLine)) (*utils.Result, error) {
+	ctx, end, err := r.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	release, err := r.limiter.Acquire(ctx, req.Value, req.Command.Lock)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var output strings.Builder
+	start := time.Now()
+	result, err := utils.StreamCommand(ctx, req.Command.Command, r.options(req), func(line utils.OutputLine) {
+		output.WriteString(line.Text)
+		output.WriteByte('\n')
+		onLine(line)
+	})
+
+	exitCode := utils.ExitCode(err)
+	if result != nil {
+		exitCode = result.ExitCode
+	}
+	r.record(req, start, output.String(), exitCode, err)
+
+	return result, err
+}
+
+// options returns the execution options of the request, capping the output at the
+// global limit when the command doesn't set its own
+func (r *Runner) options(req Request) utils.ExecOptions {
+	opts := utils.OptionsFor(req.Command, req.Timeout)
+	if opts.MaxOutput == 0 {
+		opts.MaxOutput = r.configManager.GetConfig().Limits.MaxOutput
+	}
+	return opts
+}
+
+func (r *Runner) record(req Request, start time.Time, output string, exitCode int, err error) {
+	var cmdErr *utils.CommandError
+	timedOut := errors.As(err, &cmdErr) && cmdErr.TimedOut
+	metrics.ObserveCommand(req.Value, exitCode, time.Since(start), timedOut)
+	r.notify(req, start, output, exitCode, timedOut, err)
+
+	if r.audit == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:       start,
+		Source:     req.Source,
+		ClientIP:   req.ClientIP,
+		User:       req.User,
+		Value:      req.Value,
+		Command:    req.Command.Command,
+		ExitCode:   exitCode,
+		DurationMs: time.Since(start).Milliseconds(),
+		Output:     strings.TrimSpace(output),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := r.audit.Record(entry); err != nil {
+		logger.GetLogger().Error().Err(err).Msg("Failed to write audit entry")
+	}
+}
+
+// notify hands the outcome of an execution to the notification dispatcher
+func (r *Runner) notify(req Request, start time.Time, output string, exitCode int, timedOut bool, err error) {
+	outcome := config.NotifyOnSuccess
+	switch {
+	case timedOut:
+		outcome = config.NotifyOnTimeout
+	case err != nil || exitCode != 0:
+		outcome = config.NotifyOnFailure
+	}
+
+	event := notify.Event{
+		Time:       start,
+		Value:      req.Value,
+		Command:    req.Command.Command,
+		Source:     req.Source,
+		User:       req.User,
+		Outcome:    outcome,
+		ExitCode:   exitCode,
+		DurationMs: time.Since(start).Milliseconds(),
+		Output:     strings.TrimSpace(output),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	r.notifier.Notify(req.Command, event)
+}
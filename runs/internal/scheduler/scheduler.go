@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"runs/internal/config"
+	"runs/internal/logger"
+	"runs/internal/runner"
+	"runs/internal/utils"
+
+	"github.com/robfig/cron/v3"
+)
+
+// maxRunOutput bounds the output kept for the last run of each schedule
+const maxRunOutput = 4096
+
+// Run describes a finished scheduled execution
+type Run struct {
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	ExitCode   int       `json:"exitCode"`
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output,omitempty"`
+}
+
+// Status describes a scheduled command
+type Status struct {
+	Value    string     `json:"value"`
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"nextRun,omitempty"`
+	LastRun  *Run       `json:"lastRun,omitempty"`
+}
+
+type entry struct {
+	id      cron.EntryID
+	command config.Command
+}
+
+// Scheduler runs commands on the cron schedules declared in the configuration
+type Scheduler struct {
+	runner  *runner.Runner
+	timeout time.Duration
+	cron    *cron.Cron
+
+	mu       sync.Mutex
+	paths    map[string]string
+	entries  map[string]entry
+	running  map[string]bool
+	lastRuns map[string]Run
+}
+
+// New creates a new Scheduler. timeout applies to commands that do not configure their own.
+func New(r *runner.Runner, timeout time.Duration) *Scheduler {
+	return &Scheduler{
+		runner:   r,
+		timeout:  timeout,
+		cron:     cron.New(),
+		entries:  make(map[string]entry),
+		running:  make(map[string]bool),
+		lastRuns: make(map[string]Run),
+	}
+}
+
+// Start starts the scheduler in its own goroutine
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop stops scheduling new runs. The returned context is done once running commands finish.
+func (s *Scheduler) Stop() context.Context {
+	return s.cron.Stop()
+}
+
+// Reload replaces all schedules with the ones declared in cfg. Commands that are
+// running keep running, and the last run of each command is kept across reloads.
+func (s *Scheduler) Reload(cfg *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for value, e := range s.entries {
+		s.cron.Remove(e.id)
+		delete(s.entries, value)
+	}
+	s.paths = cfg.Paths
+
+	for _, command := range cfg.Commands {
+		if command.Schedule == "" {
+			continue
+		}
+
+		value := command.Value
+		id, err := s.cron.AddFunc(command.Schedule, func() { s.run(value) })
+		if err != nil {
+			// The schedule was validated when the config was loaded
+			logger.GetLogger().Error().Str("command", value).Err(err).Msg("Failed to schedule command")
+			continue
+		}
+		s.entries[value] = entry{id: id, command: command}
+	}
+
+	logger.GetLogger().Info().Int("schedules", len(s.entries)).Msg("Schedules loaded")
+}
+
+// Status returns the state of every scheduled command, ordered by value
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Status, 0, len(s.entries))
+	for value, e := range s.entries {
+		status := Status{
+			Value:    value,
+			Name:     e.command.Name,
+			Schedule: e.command.Schedule,
+			Running:  s.running[value],
+		}
+		if next := s.cron.Entry(e.id).Next; !next.IsZero() {
+			status.NextRun = &next
+		}
+		if run, ok := s.lastRuns[value]; ok {
+			status.LastRun = &run
+		}
+		list = append(list, status)
+	}
+
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Value < list[b].Value
+	})
+	return list
+}
+
+func (s *Scheduler) run(value string) {
+	s.mu.Lock()
+	e, ok := s.entries[value]
+	if !ok || s.running[value] {
+		s.mu.Unlock()
+		if ok {
+			logger.GetLogger().Warn().Str("command", value).Msg("Skipping scheduled run, previous run still in progress")
+		}
+		return
+	}
+	s.running[value] = true
+	paths := s.paths
+	s.mu.Unlock()
+
+	start := time.Now()
+	output, err := s.execute(e.command, paths)
+
+	run := Run{
+		StartedAt:  start,
+		DurationMs: time.Since(start).Milliseconds(),
+		ExitCode:   utils.ExitCode(err),
+		Output:     output,
+	}
+	if err != nil {
+		run.Error = err.Error()
+		if cmdErr, ok := err.(*utils.CommandError); ok {
+			run.Output = cmdErr.Output
+		}
+	}
+	if len(run.Output) > maxRunOutput {
+		run.Output = run.Output[:maxRunOutput]
+	}
+
+	s.mu.Lock()
+	s.running[value] = false
+	s.lastRuns[value] = run
+	s.mu.Unlock()
+
+	logger.GetLogger().Info().Str("command", value).Int("exitCode", run.ExitCode).Msg("Scheduled command finished")
+}
+
+func (s *Scheduler) execute(command config.Command, paths map[string]string) (string, error) {
+	req := runner.Request{
+		Value:   command.Value,
+		Command: &command,
+		Source:  runner.SourceSchedule,
+		Timeout: s.timeout,
+	}
+
+	if command.IsPipeline() {
+		steps, err := s.runner.RunPipeline(context.Background(), req)
+		return runner.FormatSteps(steps), err
+	}
+
+	// Scheduled runs have no request to take arguments from, so parameters use their defaults
+	rendered, err := command.Render(paths, nil)
+	if err != nil {
+		return "", err
+	}
+	command.Command = rendered
+
+	return s.runner.Run(context.Background(), req)
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// truncationMarker is appended to output that was cut at the byte limit
+func truncationMarker(limit int64) string {
+	return fmt.Sprintf("[output truncated at %d bytes]", limit)
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the rest,
+// so a chatty command can't grow the buffer without bound. A limit of 0 keeps everything.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+
+	remaining := b.limit - int64(b.buf.Len())
+	if int64(len(p)) > remaining {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		// Report the whole write as done so the command keeps running
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the captured output, followed by the truncation marker if output was dropped
+func (b *cappedBuffer) Bytes() []byte {
+	if !b.truncated {
+		return b.buf.Bytes()
+	}
+	return append(b.buf.Bytes(), "\n"+truncationMarker(b.limit)...)
+}
+
+// outputBudget counts the bytes streamed by writers sharing it
+type outputBudget struct {
+	limit     int64
+	used      int64
+	truncated bool
+}
+
+// take returns the part of line that still fits in the budget
+func (o *outputBudget) take(line []byte) ([]byte, bool) {
+	if o.limit <= 0 {
+		return line, true
+	}
+	if o.truncated {
+		return nil, false
+	}
+
+	remaining := o.limit - o.used
+	if int64(len(line))+1 > remaining {
+		o.truncated = true
+		if remaining <= 1 {
+			return nil, false
+		}
+		line = line[:remaining-1]
+	}
+	o.used += int64(len(line)) + 1
+	return line, true
+}
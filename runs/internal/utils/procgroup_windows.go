@@ -0,0 +1,8 @@
+//go:build windows
+
+package utils
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows, cancelling cmd only kills the shell
+func setProcessGroup(cmd *exec.Cmd) {}
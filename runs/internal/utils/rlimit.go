@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+
+	"runs/internal/config"
+)
+
+// withResourceLimits prefixes command with the ulimit calls that apply the CPU and
+// memory limits of opts. The limits are inherited by everything the shell starts.
+func withResourceLimits(command string, opts ExecOptions) (string, error) {
+	if opts.LimitCPU <= 0 && opts.LimitMemory <= 0 {
+		return command, nil
+	}
+
+	if opts.Shell == config.ShellNone {
+		return "", fmt.Errorf("resource limits need a shell, %s runs the command directly", config.ShellNone)
+	}
+	if opts.Shell == "" && runtime.GOOS == "windows" {
+		return "", fmt.Errorf("%w: resource limits", ErrUnsupportedOS)
+	}
+
+	// One limit per ulimit call, dash rejects several. Refuse to run unlimited
+	// if a limit can't be applied.
+	var prefix string
+	if opts.LimitCPU > 0 {
+		prefix += fmt.Sprintf("ulimit -t %d || exit 126\n", int64(math.Ceil(opts.LimitCPU.Seconds())))
+	}
+	if opts.LimitMemory > 0 {
+		// ulimit -v takes KiB
+		prefix += fmt.Sprintf("ulimit -v %d || exit 126\n", (opts.LimitMemory+1023)/1024)
+	}
+	return prefix + command, nil
+}
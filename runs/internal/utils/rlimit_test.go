@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithResourceLimitsRunsThroughSh(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ulimit needs a POSIX shell")
+	}
+
+	tests := []struct {
+		name string
+		opts ExecOptions
+		want string
+	}{
+		{"cpu", ExecOptions{LimitCPU: 2500 * time.Millisecond}, "3"},
+		{"memory", ExecOptions{LimitMemory: 256 << 20}, "262144"},
+		{"both", ExecOptions{LimitCPU: 5 * time.Second, LimitMemory: 256 << 20}, "5 262144"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := `echo $(ulimit -t) $(ulimit -v)`
+			if tt.opts.LimitCPU == 0 {
+				report = `ulimit -v`
+			} else if tt.opts.LimitMemory == 0 {
+				report = `ulimit -t`
+			}
+
+			script, err := withResourceLimits(report, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := exec.Command("sh", "-c", script).CombinedOutput()
+			if err != nil {
+				t.Fatalf("sh failed: %v\n%s", err, output)
+			}
+			if got := strings.TrimSpace(string(output)); got != tt.want {
+				t.Errorf("limits = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithResourceLimitsWithoutLimits(t *testing.T) {
+	script, err := withResourceLimits("echo hi", ExecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script != "echo hi" {
+		t.Errorf("script = %q, want the command unchanged", script)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setRunAs is not supported on Windows
+func setRunAs(cmd *exec.Cmd, username string) error {
+	return fmt.Errorf("%w: running as %s", ErrUnsupportedOS, username)
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"runs/internal/config"
@@ -17,6 +19,62 @@ import (
 // ErrUnsupportedOS is returned when the operating system is not supported
 var ErrUnsupportedOS = errors.New("unsupported operating system")
 
+// outputWaitDelay bounds how long Wait keeps reading output after the command exits
+const outputWaitDelay = 2 * time.Second
+
+// Stream identifies the output stream a line was read from
+type Stream string
+
+const (
+	StreamStdout Stream = "stdout"
+	StreamStderr Stream = "stderr"
+)
+
+// OutputLine is a single line of output produced by a running command
+type OutputLine struct {
+	Stream Stream `json:"stream"`
+	Text   string `json:"text"`
+}
+
+// ExecOptions controls how a command is executed
+type ExecOptions struct {
+	Timeout time.Duration
+	WorkDir string
+	Env     []string
+	Shell   string
+	RunAs   string
+	// MaxOutput caps the captured output in bytes, 0 means no cap
+	MaxOutput   int64
+	LimitCPU    time.Duration
+	LimitMemory int64
+}
+
+// OptionsFor returns the execution options configured for cmd, falling back to
+// fallbackTimeout when the command does not set its own timeout
+func OptionsFor(cmd *config.Command, fallbackTimeout time.Duration) ExecOptions {
+	opts := ExecOptions{
+		Timeout: cmd.Timeout,
+		WorkDir: cmd.WorkDir,
+		Env:     cmd.Env,
+		Shell:   cmd.Shell,
+		RunAs:   cmd.RunAs,
+
+		MaxOutput:   cmd.MaxOutput,
+		LimitCPU:    cmd.LimitCPU,
+		LimitMemory: cmd.LimitMemory,
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = fallbackTimeout
+	}
+	return opts
+}
+
+// Result describes how a command finished
+type Result struct {
+	ExitCode int
+	Duration time.Duration
+}
+
 // DisplayCommands prints available commands to stdout
 func DisplayCommands(cfg *config.Config) {
 	if cfg == nil {
@@ -26,41 +84,193 @@ func DisplayCommands(cfg *config.Config) {
 
 	fmt.Println("Available Commands:")
 	for _, cmd := range cfg.Commands {
-		fmt.Printf("%-15s - %s\n", cmd.Name, cmd.Description)
+		fmt.Printf("%-15s %-25s - %s\n", cmd.Value, cmd.Name, cmd.Description)
+	}
+}
+
+// RunCommand executes a command with the given options and returns the output and any error
+func RunCommand(ctx context.Context, command string, opts ExecOptions) (string, error) {
+	if err := validateCommandArgs(ctx, command, opts.Timeout); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	cmd, err := createOSSpecificCommand(ctx, command, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to create command: %w", err)
+	}
+
+	output := &cappedBuffer{limit: opts.MaxOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = outputWaitDelay
+
+	if err := cmd.Run(); err != nil {
+		return "", handleCommandError(ctx, command, err, output.Bytes())
+	}
+
+	return strings.TrimSpace(string(output.Bytes())), nil
+}
+
+// StreamCommand executes a command with the given options and calls onLine for every
+// line written to stdout or stderr as soon as it is produced. A non-zero exit status
+// is reported through the returned Result rather than as an error.
+func StreamCommand(ctx context.Context, command string, opts ExecOptions, onLine func(OutputLine)) (*Result, error) {
+	if err := validateCommandArgs(ctx, command, opts.Timeout); err != nil {
+		return nil, err
+	}
+
+	if onLine == nil {
+		return nil, errors.New("line callback is nil")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	cmd, err := createOSSpecificCommand(ctx, command, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create command: %w", err)
+	}
+
+	var mu sync.Mutex
+	budget := &outputBudget{limit: opts.MaxOutput}
+	stdout := &lineWriter{mu: &mu, stream: StreamStdout, budget: budget, onLine: onLine}
+	stderr := &lineWriter{mu: &mu, stream: StreamStderr, budget: budget, onLine: onLine}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = outputWaitDelay
+
+	start := time.Now()
+	err = cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	if budget.truncated {
+		onLine(OutputLine{Stream: StreamStderr, Text: truncationMarker(budget.limit)})
+	}
+
+	result := &Result{ExitCode: -1, Duration: time.Since(start)}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return result, nil
+		}
+		return result, handleCommandError(ctx, command, err, nil)
 	}
+
+	return result, nil
 }
 
-// RunCommand executes a command with a timeout and returns the output and any error
-func RunCommand(ctx context.Context, command string, timeout time.Duration) (string, error) {
+func validateCommandArgs(ctx context.Context, command string, timeout time.Duration) error {
 	if ctx == nil {
-		return "", errors.New("context is nil")
+		return errors.New("context is nil")
 	}
 
 	if command == "" {
-		return "", errors.New("command is empty")
+		return errors.New("command is empty")
 	}
 
 	if timeout <= 0 {
-		return "", errors.New("timeout must be positive")
+		return errors.New("timeout must be positive")
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
+	return nil
+}
+
+// lineWriter splits written output into lines and hands each one to onLine.
+// Writers sharing the same mutex never call onLine concurrently and draw from
+// the same output budget.
+type lineWriter struct {
+	mu     *sync.Mutex
+	stream Stream
+	buf    []byte
+	budget *outputBudget
+	onLine func(OutputLine)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	// A line longer than the whole budget can't be shown in full anyway
+	if w.budget.limit > 0 && int64(len(w.buf)) > w.budget.limit {
+		w.flush()
+	}
+	return len(p), nil
+}
 
-	cmd, err := createOSSpecificCommand(ctx, command)
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) emit(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	line, ok := w.budget.take(line)
+	if !ok {
+		return
+	}
+	w.onLine(OutputLine{Stream: w.stream, Text: string(bytes.TrimRight(line, "\r"))})
+}
+
+func createOSSpecificCommand(ctx context.Context, command string, opts ExecOptions) (*exec.Cmd, error) {
+	command, err := withResourceLimits(command, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to create command: %w", err)
+		return nil, err
 	}
 
-	output, err := cmd.CombinedOutput()
+	cmd, err := newShellCommand(ctx, command, opts)
 	if err != nil {
-		return "", handleCommandError(ctx, command, err, output)
+		return nil, err
+	}
+
+	setProcessGroup(cmd)
+	cmd.Dir = opts.WorkDir
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+
+	// su switches user on its own, every other shell needs process credentials
+	if opts.RunAs != "" && opts.Shell != config.ShellSu {
+		if err := setRunAs(cmd, opts.RunAs); err != nil {
+			return nil, err
+		}
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return cmd, nil
 }
 
-func createOSSpecificCommand(ctx context.Context, command string) (*exec.Cmd, error) {
+func newShellCommand(ctx context.Context, command string, opts ExecOptions) (*exec.Cmd, error) {
+	switch opts.Shell {
+	case config.ShellSh, config.ShellBash:
+		return exec.CommandContext(ctx, opts.Shell, "-c", command), nil
+	case config.ShellSu:
+		if opts.RunAs != "" {
+			return exec.CommandContext(ctx, "su", "-c", command, opts.RunAs), nil
+		}
+		return exec.CommandContext(ctx, "su", "-c", command), nil
+	case config.ShellNone:
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil, errors.New("command is empty")
+		}
+		return exec.CommandContext(ctx, fields[0], fields[1:]...), nil
+	}
+
 	switch os := runtime.GOOS; os {
 	case "windows":
 		return exec.CommandContext(ctx, "cmd.exe", "/C", command), nil
@@ -74,21 +284,71 @@ func createOSSpecificCommand(ctx context.Context, command string) (*exec.Cmd, er
 }
 
 func handleCommandError(ctx context.Context, command string, err error, output []byte) error {
-	if ctx.Err() == context.DeadlineExceeded {
-		return fmt.Errorf("command timed out: %s", command)
+	cmdErr := &CommandError{
+		Command:  command,
+		ExitCode: -1,
+		TimedOut: ctx.Err() == context.DeadlineExceeded,
+		Canceled: ctx.Err() == context.Canceled,
+		Output:   string(output),
+		Err:      err,
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		cmdErr.ExitCode = exitErr.ExitCode()
+	}
+
+	return cmdErr
+}
+
+// CommandError describes a command that could not be run or did not exit successfully
+type CommandError struct {
+	Command  string
+	ExitCode int // -1 if the command did not exit on its own
+	TimedOut bool
+	Canceled bool
+	Output   string
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	if e.TimedOut {
+		return fmt.Sprintf("command timed out: %s", e.Command)
+	}
+
+	if e.Canceled {
+		return fmt.Sprintf("command canceled: %s", e.Command)
 	}
 
-	if errors.Is(err, exec.ErrNotFound) {
-		return fmt.Errorf("command not found: %s", command)
+	if errors.Is(e.Err, exec.ErrNotFound) {
+		return fmt.Sprintf("command not found: %s", e.Command)
 	}
 
-	if errors.Is(err, os.ErrPermission) {
-		return fmt.Errorf("permission denied: %s", command)
+	if errors.Is(e.Err, os.ErrPermission) {
+		return fmt.Sprintf("permission denied: %s", e.Command)
 	}
 
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		return fmt.Errorf("command exited with code %d: %s\nOutput: %s", exitErr.ExitCode(), command, string(output))
+	if e.ExitCode >= 0 {
+		return fmt.Sprintf("command exited with code %d: %s\nOutput: %s", e.ExitCode, e.Command, e.Output)
 	}
 
-	return fmt.Errorf("error running command '%s': %w\nOutput: %s", command, err, string(output))
-}
\ No newline at end of file
+	return fmt.Sprintf("error running command '%s': %v\nOutput: %s", e.Command, e.Err, e.Output)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code carried by err: 0 for nil and -1 when the
+// command did not exit on its own
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.ExitCode
+	}
+	return -1
+}
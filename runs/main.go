@@ -3,17 +3,28 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runs/internal/audit"
+	"runs/internal/auth"
 	"runs/internal/config"
 	"runs/internal/handlers"
+	"runs/internal/jobs"
+	"runs/internal/limiter"
 	"runs/internal/logger"
+	"runs/internal/metrics"
+	"runs/internal/notify"
+	"runs/internal/runner"
+	"runs/internal/scheduler"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -25,16 +36,30 @@ import (
 )
 
 const (
-	configFilePath         = "./config.ini"
+	defaultConfigFilePath  = "./config.ini"
 	defaultPort            = ":5678"
 	reloadDebounceDuration = 2 * time.Second
+	jobHistorySize         = 100
+	jobTimeout             = time.Hour
+	// serverShutdownTimeout bounds how long open connections, such as streams, keep the server up
+	serverShutdownTimeout  = 5 * time.Second
+	// notifyShutdownTimeout bounds how long queued notifications may delay the exit
+	notifyShutdownTimeout  = 10 * time.Second
 )
 
 //go:embed frontend/dist/*
 var embeddedFiles embed.FS
 
 type application struct {
+	configPath    string
 	config        *config.ConfigManager
+	jobs          *jobs.Manager
+	auth          *auth.Manager
+	audit         *audit.Store
+	runner        *runner.Runner
+	limiter       *limiter.Limiter
+	notifier      *notify.Dispatcher
+	scheduler     *scheduler.Scheduler
 	app           *fiber.App
 	reloadTimer   *time.Timer
 	reloadMutex   sync.Mutex
@@ -52,26 +77,100 @@ func main() {
         panic(err)
     }
 
-	app := newApplication()
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		// Without a subcommand runs starts the server, as it always has
+		args = append([]string{"serve"}, args...)
+	}
+
+	switch args[0] {
+	case "serve":
+		serve(args[1:])
+	case "list":
+		quietLogs()
+		if err := listCommands(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	case "exec":
+		quietLogs()
+		exitCode, err := execCommand(args[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(exitCode)
+	case "migrate-config":
+		if err := migrateConfig(args[1:]); err != nil {
+			logger.GetLogger().Fatal().Err(err).Msg("Error migrating config")
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\nUsage:\n  runs serve [-config FILE]\n  runs list [-config FILE | -remote URL]\n  runs exec <value> [--param key=value]... [-config FILE | -remote URL]\n  runs migrate-config -from FILE -to FILE\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigFilePath, "path to the config file (.ini, .json, .yaml)")
+	flags.Parse(args)
+
+	app := newApplication(*configPath)
 	app.run()
 }
 
-func newApplication() *application {
-	configProvider := config.NewFileConfigProvider(configFilePath, *logger.GetLogger())
+// migrateConfig converts a config file into another format
+func migrateConfig(args []string) error {
+	flags := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	from := flags.String("from", defaultConfigFilePath, "config file to convert")
+	to := flags.String("to", "./config.yaml", "file to write, its extension picks the format (.json, .yaml)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := config.Migrate(*from, *to, *logger.GetLogger()); err != nil {
+		return err
+	}
+
+	logger.GetLogger().Info().Str("from", *from).Str("to", *to).Msg("Config migrated")
+	return nil
+}
+
+func newApplication(configPath string) *application {
+	configProvider, err := config.NewProvider(configPath, *logger.GetLogger())
+	if err != nil {
+		logger.GetLogger().Fatal().Err(err).Msg("Error loading config")
+	}
 	configManager := config.NewConfigManager(configProvider, *logger.GetLogger())
 
 	if err := configManager.Load(context.Background()); err != nil {
 		logger.GetLogger().Fatal().Err(err).Msg("Error loading config")
 	}
+	metrics.ObserveConfigReload(nil)
 	// configManager.LogConfig()
 
+	auditStore, err := openAuditStore(configManager.GetConfig().Audit)
+	if err != nil {
+		logger.GetLogger().Fatal().Err(err).Msg("Error opening audit log")
+	}
+	commandLimiter := limiter.New(configManager)
+	notifier := notify.New(configManager)
+	commandRunner := runner.New(configManager, auditStore, commandLimiter, notifier)
+
 	fiberApp := fiber.New(fiber.Config{
 		DisablePreParseMultipartForm: true,
 		StreamRequestBody:            true,
 	})
 
 	return &application{
+		configPath:   configPath,
 		config:       configManager,
+		jobs:         jobs.NewManager(commandRunner, jobHistorySize, jobTimeout),
+		auth:         auth.NewManager(configManager),
+		audit:        auditStore,
+		runner:       commandRunner,
+		limiter:      commandLimiter,
+		notifier:     notifier,
+		scheduler:    scheduler.New(commandRunner, jobTimeout),
 		app:          fiberApp,
 		shutdownChan: make(chan os.Signal, 1),
 	}
@@ -83,6 +182,9 @@ func (a *application) run() {
 
 	go a.startServer()
 
+	a.scheduler.Reload(a.config.GetConfig())
+	a.scheduler.Start()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -95,36 +197,103 @@ func (a *application) run() {
 		}
 	}()
 
-	signal.Notify(a.shutdownChan, os.Interrupt)
-	<-a.shutdownChan
+	signal.Notify(a.shutdownChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range a.shutdownChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		a.reloadConfig()
+	}
 
 	logger.GetLogger().Info().Msg("Shutting down gracefully...")
+	a.scheduler.Stop()
+
+	grace := a.config.GetConfig().WebConf.ShutdownGrace
+	if !a.runner.Shutdown(grace) {
+		logger.GetLogger().Warn().Dur("grace", grace).Msg("Killed commands still running after the grace period")
+	}
+
+	notifyCtx, cancelNotify := context.WithTimeout(context.Background(), notifyShutdownTimeout)
+	a.notifier.Close(notifyCtx)
+	cancelNotify()
+
 	cancel()
 	wg.Wait()
-	if err := a.app.Shutdown(); err != nil {
+	if err := a.app.ShutdownWithTimeout(serverShutdownTimeout); err != nil {
 		logger.GetLogger().Error().Err(err).Msg("Error during server shutdown")
 	}
+	if a.audit != nil {
+		if err := a.audit.Close(); err != nil {
+			logger.GetLogger().Error().Err(err).Msg("Error closing audit log")
+		}
+	}
+}
+
+// openAuditStore opens the audit log, or returns nil when auditing is disabled
+func openAuditStore(auditConf config.AuditConf) (*audit.Store, error) {
+	if !auditConf.Enabled {
+		return nil, nil
+	}
+	return audit.Open(audit.Options{
+		Path:       auditConf.File,
+		MaxSize:    int64(auditConf.MaxSizeMB) * 1024 * 1024,
+		MaxBackups: auditConf.MaxBackups,
+		MaxOutput:  auditConf.MaxOutput,
+	})
 }
 
 func (a *application) setupMiddleware() {
+	allowOrigins := a.config.GetConfig().WebConf.AllowOrigins
 	a.app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
+		AllowOrigins: allowOrigins,
 		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Content-Type",
+		AllowHeaders: "Content-Type,Authorization",
+		// Browsers refuse credentials for wildcard origins
+		AllowCredentials: allowOrigins != "*",
 	}))
 
 	a.app.Use(compress.New(compress.Config{
+		// Compressing server-sent events would buffer them until the stream ends
+		Next: func(c *fiber.Ctx) bool {
+			return c.Path() == "/api/command/stream"
+		},
 		Level: compress.LevelBestSpeed,
 	}))
 
 	a.app.Use(a.requestLoggerMiddleware())
+	a.app.Use("/api", a.auth.Middleware("/api/auth/login"))
 }
 
 func (a *application) setupRoutes() {
-	handler := handlers.NewHandler(a.config)
+	handler := handlers.NewHandler(a.config, a.jobs, a.auth, a.runner, a.audit, a.scheduler, a.limiter)
+
+	a.app.Post("/api/auth/login", handler.Login)
+	a.app.Post("/api/auth/logout", handler.Logout)
+	a.app.Get("/api/auth/me", handler.CurrentUser)
 
 	a.app.Get("/api/command/list", handler.GetCommandList)
 	a.app.Post("/api/command/execute", handler.CommandHandler)
+	a.app.Get("/api/command/stream", handler.StreamCommandHandler)
+
+	a.app.Get("/api/jobs", handler.ListJobs)
+	a.app.Post("/api/jobs", handler.StartJob)
+	a.app.Get("/api/jobs/:id", handler.GetJob)
+	a.app.Delete("/api/jobs/:id", handler.CancelJob)
+
+	a.app.Get("/api/audit", handler.GetAuditLog)
+	a.app.Get("/api/schedules", handler.GetSchedules)
+	a.app.Get("/api/locks", handler.GetLocks)
+	a.app.Get("/api/config/status", handler.GetConfigStatus)
+
+	// Metrics reveal command names and activity, so they need a session like the
+	// API unless publicMetrics opens them up for a scraper on a trusted network
+	metricsAuth := a.auth.Middleware()
+	a.app.Get("/metrics", func(c *fiber.Ctx) error {
+		if a.config.GetConfig().WebConf.PublicMetrics {
+			return c.Next()
+		}
+		return metricsAuth(c)
+	}, metrics.Handler())
 
 	a.app.Use("/", filesystem.New(filesystem.Config{
 		Root:       http.FS(embeddedFiles),
@@ -154,7 +323,7 @@ func (a *application) setupFileWatcher(ctx context.Context) error {
 	}
 	defer watcher.Close()
 
-	if err := watcher.Add(configFilePath); err != nil {
+	if err := watcher.Add(a.configPath); err != nil {
 		logger.GetLogger().Error().Err(err).Msg("Error adding file to watcher")
 		return fmt.Errorf("adding file to watcher: %w", err)
 	}
@@ -190,14 +359,26 @@ func (a *application) debounceConfigReload() {
 	if a.reloadTimer != nil {
 		a.reloadTimer.Stop()
 	}
-	a.reloadTimer = time.AfterFunc(reloadDebounceDuration, func() {
-		logger.GetLogger().Info().Msg("Reloading config...")
-		if err := a.config.Load(context.Background()); err != nil {
-			logger.GetLogger().Warn().Err(err).Msg("Error reloading config")
-		} else {
-			logger.GetLogger().Info().Str("file", configFilePath).Msg("Config file reloaded")
-		}
-	})
+	a.reloadTimer = time.AfterFunc(reloadDebounceDuration, a.reloadConfig)
+}
+
+// reloadConfig loads the config file again, keeping the current config if the new one is invalid
+func (a *application) reloadConfig() {
+	logger.GetLogger().Info().Msg("Reloading config...")
+	err := a.config.Load(context.Background())
+	metrics.ObserveConfigReload(err)
+	if err != nil {
+		logger.GetLogger().Warn().Err(err).Msg("Error reloading config, keeping the previous one")
+	} else {
+		status := a.config.Status()
+		logger.GetLogger().Info().
+			Str("file", a.configPath).
+			Str("added", strings.Join(status.Added, ",")).
+			Str("removed", strings.Join(status.Removed, ",")).
+			Str("changed", strings.Join(status.Changed, ",")).
+			Msg("Config file reloaded")
+		a.scheduler.Reload(a.config.GetConfig())
+	}
 }
 
 func (a *application) requestLoggerMiddleware() fiber.Handler {
@@ -205,10 +386,22 @@ func (a *application) requestLoggerMiddleware() fiber.Handler {
 		start := time.Now()
 		err := c.Next()
 		duration := time.Since(start)
+
+		// Errors returned by handlers only reach the response after the middleware chain
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+		metrics.ObserveRequest(c.Method(), c.Route().Path, status, duration)
+
 		logger.GetLogger().Info().
 			Str("method", c.Method()).
 			Str("path", c.Path()).
-			Int("status", c.Response().StatusCode()).
+			Int("status", status).
 			Dur("duration", duration).
 			Msg("Request")
 		return err